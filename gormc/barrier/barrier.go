@@ -0,0 +1,170 @@
+package barrier
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTableName is the barrier table name, compatible with dtm's dtm_barrier.barrier.
+const DefaultTableName = "barrier"
+
+// barrierID identifies the barrier inside a branch, one CallWithBarrier per branch op is supported.
+const barrierID = "01"
+
+const (
+	TransTypeSaga = "saga"
+	TransTypeTcc  = "tcc"
+	TransTypeMsg  = "msg"
+
+	OpTry        = "try"
+	OpConfirm    = "confirm"
+	OpCancel     = "cancel"
+	OpAction     = "action"
+	OpCompensate = "compensate"
+	OpMsg        = "msg"
+)
+
+// ErrUnknownOp is returned when op is not a known branch op.
+var ErrUnknownOp = errors.New("barrier: unknown branch op")
+
+var (
+	// originOps maps a compensation op to the op it compensates.
+	originOps = map[string]string{
+		OpCancel:     OpTry,
+		OpCompensate: OpAction,
+	}
+	transTypes = map[string]string{
+		OpTry:        TransTypeTcc,
+		OpConfirm:    TransTypeTcc,
+		OpCancel:     TransTypeTcc,
+		OpAction:     TransTypeSaga,
+		OpCompensate: TransTypeSaga,
+		OpMsg:        TransTypeMsg,
+	}
+)
+
+type (
+	// Transactor runs fn in a transaction, gormc.CachedConn and gormc.Conn satisfy it.
+	Transactor interface {
+		TransactCtx(ctx context.Context, fn func(db *gorm.DB) error, opts ...*sql.TxOptions) error
+	}
+
+	// Option customizes a Barrier.
+	Option func(b *Barrier)
+
+	// Barrier makes branch ops of a distributed transaction idempotent,
+	// and prevents null compensation and dangling actions.
+	Barrier struct {
+		conn  Transactor
+		table string
+	}
+
+	// Record is the gorm model of the barrier table.
+	Record struct {
+		Id         uint64    `gorm:"column:id;primaryKey;autoIncrement"`
+		TransType  string    `gorm:"column:trans_type;type:varchar(45);default:''"`
+		Gid        string    `gorm:"column:gid;type:varchar(128);default:'';uniqueIndex:uniq_barrier,priority:1"`
+		BranchId   string    `gorm:"column:branch_id;type:varchar(128);default:'';uniqueIndex:uniq_barrier,priority:2"`
+		Op         string    `gorm:"column:op;type:varchar(45);default:'';uniqueIndex:uniq_barrier,priority:3"`
+		BarrierId  string    `gorm:"column:barrier_id;type:varchar(45);default:'';uniqueIndex:uniq_barrier,priority:4"`
+		Reason     string    `gorm:"column:reason;type:varchar(45);default:''"`
+		CreateTime time.Time `gorm:"column:create_time;autoCreateTime"`
+		UpdateTime time.Time `gorm:"column:update_time;autoUpdateTime"`
+	}
+)
+
+func (Record) TableName() string {
+	return DefaultTableName
+}
+
+// New returns a Barrier that runs on conn.
+func New(conn Transactor, opts ...Option) *Barrier {
+	b := &Barrier{
+		conn:  conn,
+		table: DefaultTableName,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// WithTableName sets the barrier table name, e.g. dtm_barrier.barrier.
+func WithTableName(table string) Option {
+	return func(b *Barrier) {
+		if len(table) > 0 {
+			b.table = table
+		}
+	}
+}
+
+// AutoMigrate creates or updates the barrier table.
+func (b *Barrier) AutoMigrate(db *gorm.DB) error {
+	return db.Table(b.table).AutoMigrate(&Record{})
+}
+
+// CallWithBarrier runs fn inside a transaction guarded by the branch barrier.
+// fn is skipped, and nil is returned, when the op was already done, when it is a
+// compensation of an op that never ran, or when the op arrives after its compensation.
+func (b *Barrier) CallWithBarrier(ctx context.Context, gid, branchID, op string, fn func(tx *gorm.DB) error) error {
+	transType, ok := transTypes[op]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownOp, op)
+	}
+
+	return b.conn.TransactCtx(ctx, func(tx *gorm.DB) error {
+		var originAffected int64
+		originOp, isCompensation := originOps[op]
+		if isCompensation {
+			affected, err := b.insert(tx, transType, gid, branchID, originOp, op)
+			if err != nil {
+				return err
+			}
+			originAffected = affected
+		}
+
+		currentAffected, err := b.insert(tx, transType, gid, branchID, op, op)
+		if err != nil {
+			return err
+		}
+
+		// null compensation: the origin op never ran, so there is nothing to compensate.
+		if isCompensation && originAffected > 0 {
+			return nil
+		}
+		// duplicate call, or a dangling op arriving after its compensation.
+		if currentAffected == 0 {
+			return nil
+		}
+
+		return fn(tx)
+	})
+}
+
+func (b *Barrier) insert(tx *gorm.DB, transType, gid, branchID, op, reason string) (int64, error) {
+	stmt, err := insertIgnoreSQL(tx.Dialector.Name(), tx.Statement.Quote(b.table))
+	if err != nil {
+		return 0, err
+	}
+	res := tx.Exec(stmt, transType, gid, branchID, op, barrierID, reason)
+	return res.RowsAffected, res.Error
+}
+
+func insertIgnoreSQL(dialect, table string) (string, error) {
+	const columns = "(trans_type, gid, branch_id, op, barrier_id, reason) VALUES (?, ?, ?, ?, ?, ?)"
+	switch dialect {
+	case "mysql":
+		return "INSERT IGNORE INTO " + table + " " + columns, nil
+	case "postgres":
+		return "INSERT INTO " + table + " " + columns + " ON CONFLICT DO NOTHING", nil
+	case "sqlite":
+		return "INSERT OR IGNORE INTO " + table + " " + columns, nil
+	default:
+		return "", fmt.Errorf("barrier: dialect %s is not supported", dialect)
+	}
+}
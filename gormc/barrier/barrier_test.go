@@ -0,0 +1,123 @@
+package barrier
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/SpectatorNan/gorm-zero/gormc"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func createTestBarrier(t *testing.T) (*Barrier, *gorm.DB) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	b := New(gormc.NewConnNoCache(db))
+	if err = b.AutoMigrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return b, db
+}
+
+func TestCallWithBarrier(t *testing.T) {
+	ctx := context.Background()
+	counter := func(n *int) func(tx *gorm.DB) error {
+		return func(tx *gorm.DB) error {
+			*n++
+			return nil
+		}
+	}
+
+	t.Run("duplicate call runs once", func(t *testing.T) {
+		b, _ := createTestBarrier(t)
+		var n int
+		for i := 0; i < 3; i++ {
+			if err := b.CallWithBarrier(ctx, "gid1", "01", OpTry, counter(&n)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n != 1 {
+			t.Fatalf("expected 1 call, got %d", n)
+		}
+	})
+
+	t.Run("compensation after action", func(t *testing.T) {
+		b, _ := createTestBarrier(t)
+		var action, compensate int
+		if err := b.CallWithBarrier(ctx, "gid2", "01", OpAction, counter(&action)); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.CallWithBarrier(ctx, "gid2", "01", OpCompensate, counter(&compensate)); err != nil {
+			t.Fatal(err)
+		}
+		if action != 1 || compensate != 1 {
+			t.Fatalf("expected action and compensate once, got %d %d", action, compensate)
+		}
+	})
+
+	t.Run("null compensation and dangling action", func(t *testing.T) {
+		b, _ := createTestBarrier(t)
+		var try, cancel int
+		if err := b.CallWithBarrier(ctx, "gid3", "01", OpCancel, counter(&cancel)); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.CallWithBarrier(ctx, "gid3", "01", OpTry, counter(&try)); err != nil {
+			t.Fatal(err)
+		}
+		if try != 0 || cancel != 0 {
+			t.Fatalf("expected no calls, got try %d cancel %d", try, cancel)
+		}
+	})
+
+	t.Run("failed fn rolls back barrier", func(t *testing.T) {
+		b, db := createTestBarrier(t)
+		boom := errors.New("boom")
+		err := b.CallWithBarrier(ctx, "gid4", "01", OpTry, func(tx *gorm.DB) error {
+			return boom
+		})
+		if !errors.Is(err, boom) {
+			t.Fatalf("expected boom, got %v", err)
+		}
+		var cnt int64
+		db.Model(&Record{}).Count(&cnt)
+		if cnt != 0 {
+			t.Fatalf("expected barrier to be rolled back, got %d rows", cnt)
+		}
+
+		var n int
+		if err = b.CallWithBarrier(ctx, "gid4", "01", OpTry, counter(&n)); err != nil || n != 1 {
+			t.Fatalf("expected retry to run, got %d %v", n, err)
+		}
+	})
+
+	t.Run("unknown op", func(t *testing.T) {
+		b, _ := createTestBarrier(t)
+		err := b.CallWithBarrier(ctx, "gid5", "01", "rollback", counter(new(int)))
+		if !errors.Is(err, ErrUnknownOp) {
+			t.Fatalf("expected ErrUnknownOp, got %v", err)
+		}
+	})
+}
+
+func TestInsertIgnoreSQL(t *testing.T) {
+	cases := map[string]string{
+		"mysql":    "INSERT IGNORE INTO `barrier` ",
+		"postgres": "INSERT INTO `barrier` ",
+		"sqlite":   "INSERT OR IGNORE INTO `barrier` ",
+	}
+	for dialect, prefix := range cases {
+		stmt, err := insertIgnoreSQL(dialect, "`barrier`")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stmt) < len(prefix) || stmt[:len(prefix)] != prefix {
+			t.Errorf("%s: unexpected sql %s", dialect, stmt)
+		}
+	}
+	if _, err := insertIgnoreSQL("sqlserver", "barrier"); err == nil {
+		t.Error("expected unsupported dialect error")
+	}
+}
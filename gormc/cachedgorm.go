@@ -6,6 +6,8 @@ import (
 	"errors"
 	"time"
 
+	"github.com/SpectatorNan/gorm-zero/gormc/plugins"
+	"github.com/SpectatorNan/gorm-zero/gormc/tenant"
 	"github.com/zeromicro/go-zero/core/mathx"
 	"github.com/zeromicro/go-zero/core/stores/cache"
 	"github.com/zeromicro/go-zero/core/stores/redis"
@@ -52,26 +54,37 @@ type (
 
 	CachedConn struct {
 		db                 *gorm.DB
+		router             *TenantRouter
+		tenantKeys         bool
 		cache              cache.Cache
+		tenantCache        cache.Cache
+		locker             Locker
+		tracker            *WriteTracker
 		unstableExpiryTime mathx.Unstable
 	}
 
 	Conn struct {
-		db *gorm.DB
+		db     *gorm.DB
+		router *TenantRouter
 	}
 )
 
 // NewConn returns a CachedConn with a redis cluster cache.
 func NewConn(db *gorm.DB, c cache.CacheConf, opts ...cache.Option) CachedConn {
 	cc := cache.New(c, singleFlights, stats, ErrNotFound, opts...)
-	return NewConnWithCache(db, cc)
+	return NewConnWithCache(db, cc).WithLocker(newClusterLocker(c))
 }
 
 // NewConnWithCache returns a CachedConn with a custom cache.
+// Use WithLocker to enable WithLockCtx.
+// If db uses plugins.TenantPlugin, every cache key is prefixed by the tenant in ctx,
+// the plugin is looked up on each call, so it can be installed after the conn is created.
 func NewConnWithCache(db *gorm.DB, c cache.Cache) CachedConn {
+	registerWriteRecorder(db)
 	return CachedConn{
 		db:                 db,
 		cache:              c,
+		tenantCache:        tenant.NewCache(c),
 		unstableExpiryTime: mathx.NewUnstable(expiryDeviation),
 	}
 }
@@ -79,27 +92,69 @@ func NewConnWithCache(db *gorm.DB, c cache.Cache) CachedConn {
 // NewNodeConn returns a CachedConn with a redis node cache.
 func NewNodeConn(db *gorm.DB, rds *redis.Redis, opts ...cache.Option) CachedConn {
 	cc := cache.NewNode(rds, singleFlights, stats, ErrNotFound, opts...)
-	return NewConnWithCache(db, cc)
+	return NewConnWithCache(db, cc).WithLocker(NewRedisLocker(rds))
+}
+
+// NewTenantConn returns a CachedConn that runs on the database of the tenant in ctx,
+// with every cache key prefixed by the tenant.
+func NewTenantConn(router *TenantRouter, c cache.CacheConf, opts ...cache.Option) CachedConn {
+	cc := cache.New(c, singleFlights, stats, ErrNotFound, opts...)
+	return NewTenantConnWithCache(router, cc).WithLocker(newClusterLocker(c))
+}
+
+// NewTenantConnWithCache returns a tenant CachedConn with a custom cache.
+func NewTenantConnWithCache(router *TenantRouter, c cache.Cache) CachedConn {
+	return CachedConn{
+		router:             router,
+		tenantKeys:         true,
+		cache:              c,
+		tenantCache:        tenant.NewCache(c),
+		unstableExpiryTime: mathx.NewUnstable(expiryDeviation),
+	}
+}
+
+// dbOf returns the database of the tenant in ctx for tenant conns, with the release of its lease.
+func (cc CachedConn) dbOf(ctx context.Context) (*gorm.DB, func(), error) {
+	if cc.router == nil {
+		return cc.db, func() {}, nil
+	}
+	return cc.router.Acquire(ctx)
+}
+
+// usesTenantKeys reports whether the cache keys are prefixed by the tenant in ctx.
+func (cc CachedConn) usesTenantKeys() bool {
+	if cc.tenantKeys {
+		return true
+	}
+	return cc.db != nil && plugins.UsesTenantPlugin(cc.db)
+}
+
+// cacheOf returns the cache prefixing the keys by the tenant in ctx if the conn uses tenant keys.
+func (cc CachedConn) cacheOf() cache.Cache {
+	if cc.usesTenantKeys() {
+		return cc.tenantCache
+	}
+	return cc.cache
 }
 
 // DelCache deletes cache with keys.
 func (cc CachedConn) DelCache(keys ...string) error {
-	return cc.cache.DelCtx(context.Background(), keys...)
+	return cc.cacheOf().DelCtx(context.Background(), keys...)
 }
 
 // DelCacheCtx deletes cache with keys.
 func (cc CachedConn) DelCacheCtx(ctx context.Context, keys ...string) error {
-	return cc.cache.DelCtx(ctx, keys...)
+	return cc.cacheOf().DelCtx(ctx, keys...)
 }
 
 // GetCache unmarshals cache with given key into v.
 func (cc CachedConn) GetCache(key string, v interface{}) error {
-	return cc.cache.GetCtx(context.Background(), key, v)
+	return cc.cacheOf().GetCtx(context.Background(), key, v)
 }
 
 // GetCacheCtx unmarshals cache with given key into v.
 func (cc CachedConn) GetCacheCtx(ctx context.Context, key string, v interface{}) error {
-	return cc.cache.GetCtx(ctx, key, v)
+	return cc.cacheOf().GetCtx(ctx, key, v)
 }
 
 // Exec runs given exec on given keys, and returns execution result.
@@ -109,7 +164,7 @@ func (cc CachedConn) Exec(exec ExecCtxFn, keys ...string) error {
 
 // ExecCtx runs given exec on given keys, and returns execution result.
 func (cc CachedConn) ExecCtx(ctx context.Context, execCtx ExecCtxFn, keys ...string) error {
-	err := execCtx(cc.db.WithContext(ctx))
+	err := cc.execWithTracking(ctx, execCtx, keys)
 	if err != nil {
 		return err
 	}
@@ -119,6 +174,23 @@ func (cc CachedConn) ExecCtx(ctx context.Context, execCtx ExecCtxFn, keys ...str
 	return nil
 }
 
+// NewConnNoCache returns a Conn without cache.
+func NewConnNoCache(db *gorm.DB) Conn {
+	return Conn{db: db}
+}
+
+// NewTenantConnNoCache returns a Conn without cache that runs on the database of the tenant in ctx.
+func NewTenantConnNoCache(router *TenantRouter) Conn {
+	return Conn{router: router}
+}
+
+func (cc Conn) dbOf(ctx context.Context) (*gorm.DB, func(), error) {
+	if cc.router == nil {
+		return cc.db, func() {}, nil
+	}
+	return cc.router.Acquire(ctx)
+}
+
 // ExecNoCache runs exec with given sql statement, without affecting cache.
 func (cc Conn) ExecNoCache(exec ExecCtxFn) error {
 	return cc.ExecNoCacheCtx(context.Background(), exec)
@@ -130,7 +202,50 @@ func (cc Conn) ExecNoCacheCtx(ctx context.Context, execCtx ExecCtxFn) (err error
 	defer func() {
 		endSpan(span, err)
 	}()
-	return execCtx(cc.db.WithContext(ctx))
+	db, release, err := cc.dbOf(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return execCtx(db.WithContext(ctx))
+}
+
+// QueryNoCache runs query without cache.
+func (cc Conn) QueryNoCache(query QueryCtxFn) error {
+	return cc.QueryNoCacheCtx(context.Background(), query)
+}
+
+// QueryNoCacheCtx runs query without cache.
+func (cc Conn) QueryNoCacheCtx(ctx context.Context, query QueryCtxFn) (err error) {
+	ctx, span := startSpan(ctx, "QueryNoCache")
+	defer func() {
+		endSpan(span, err)
+	}()
+	db, release, err := cc.dbOf(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return query(db.WithContext(ctx))
+}
+
+// Transact runs given fn in transaction mode.
+func (cc Conn) Transact(fn func(db *gorm.DB) error, opts ...*sql.TxOptions) error {
+	return cc.TransactCtx(context.Background(), fn, opts...)
+}
+
+// TransactCtx runs given fn in transaction mode.
+func (cc Conn) TransactCtx(ctx context.Context, fn func(db *gorm.DB) error, opts ...*sql.TxOptions) (err error) {
+	ctx, span := startSpan(ctx, "Transact")
+	defer func() {
+		endSpan(span, err)
+	}()
+	db, release, err := cc.dbOf(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return db.WithContext(ctx).Transaction(fn, opts...)
 }
 
 // ExecNoCache runs exec with given sql statement, without affecting cache.
@@ -144,7 +259,12 @@ func (cc CachedConn) ExecNoCacheCtx(ctx context.Context, execCtx ExecCtxFn) (err
 	defer func() {
 		endSpan(span, err)
 	}()
-	return execCtx(cc.db.WithContext(ctx))
+	db, release, err := cc.dbOf(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return execCtx(db.WithContext(ctx))
 }
 
 // QueryRowIndex unmarshals into v with given key.
@@ -163,21 +283,31 @@ func (cc CachedConn) QueryRowIndexCtx(ctx context.Context, v interface{}, key st
 	var primaryKey interface{}
 	var found bool
 
-	if err = cc.cache.TakeWithExpireCtx(ctx, &primaryKey, key, func(val interface{}, expire time.Duration) error {
-		primaryKey, err = indexQuery(cc.db.WithContext(ctx), v)
+	if err = cc.cacheOf().TakeWithExpireCtx(ctx, &primaryKey, key, func(val interface{}, expire time.Duration) error {
+		db, release, err := cc.dbOf(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		primaryKey, err = indexQuery(db.WithContext(cc.readCtx(ctx, key)), v)
 		if err != nil {
 			return err
 		}
 		found = true
-		return cc.cache.SetWithExpireCtx(ctx, keyer(primaryKey), v, expire+cacheSafeGapBetweenIndexAndPrimary)
+		return cc.cacheOf().SetWithExpireCtx(ctx, keyer(primaryKey), v, expire+cacheSafeGapBetweenIndexAndPrimary)
 	}); err != nil {
 		return err
 	}
 	if found {
 		return nil
 	}
-	return cc.cache.TakeCtx(ctx, v, keyer(primaryKey), func(v interface{}) error {
-		return primaryQuery(cc.db.WithContext(ctx), v, primaryKey)
+	return cc.cacheOf().TakeCtx(ctx, v, keyer(primaryKey), func(v interface{}) error {
+		db, release, err := cc.dbOf(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return primaryQuery(db.WithContext(cc.readCtx(ctx, key, keyer(primaryKey))), v, primaryKey)
 	})
 }
 
@@ -186,8 +316,13 @@ func (cc CachedConn) QueryCtx(ctx context.Context, v interface{}, key string, qu
 	defer func() {
 		endSpan(span, err)
 	}()
-	return cc.cache.TakeCtx(ctx, v, key, func(v interface{}) error {
-		return query(cc.db.WithContext(ctx))
+	return cc.cacheOf().TakeCtx(ctx, v, key, func(v interface{}) error {
+		db, release, err := cc.dbOf(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return query(db.WithContext(cc.readCtx(ctx, key)))
 	})
 }
 
@@ -196,7 +331,12 @@ func (cc CachedConn) QueryNoCacheCtx(ctx context.Context, query QueryCtxFn) (err
 	defer func() {
 		endSpan(span, err)
 	}()
-	return query(cc.db.WithContext(ctx))
+	db, release, err := cc.dbOf(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return query(db.WithContext(ctx))
 }
 
 // QueryWithExpireCtx unmarshals into v with given key, set expire duration and query func.
@@ -205,13 +345,18 @@ func (cc CachedConn) QueryWithExpireCtx(ctx context.Context, v interface{}, key
 	defer func() {
 		endSpan(span, err)
 	}()
-	err = cc.cache.TakeCtx(ctx, v, key, func(v interface{}) error {
-		return query(cc.db.WithContext(ctx))
+	err = cc.cacheOf().TakeCtx(ctx, v, key, func(v interface{}) error {
+		db, release, err := cc.dbOf(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return query(db.WithContext(cc.readCtx(ctx, key)))
 	})
 	if err != nil {
 		return err
 	}
-	return cc.cache.SetWithExpireCtx(ctx, key, v, cc.aroundDuration(expire))
+	return cc.cacheOf().SetWithExpireCtx(ctx, key, v, cc.aroundDuration(expire))
 }
 
 // QueryWithCallbackExpireCtx unmarshals into v with given key, set expire duration from callback and query func.
@@ -220,8 +365,13 @@ func (cc CachedConn) QueryWithCallbackExpireCtx(ctx context.Context, v interface
 	defer func() {
 		endSpan(span, err)
 	}()
-	err = cc.cache.TakeCtx(ctx, v, key, func(v interface{}) error {
-		return query(cc.db.WithContext(ctx))
+	err = cc.cacheOf().TakeCtx(ctx, v, key, func(v interface{}) error {
+		db, release, err := cc.dbOf(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return query(db.WithContext(cc.readCtx(ctx, key)))
 	})
 	if err != nil {
 		return err
@@ -229,7 +379,7 @@ func (cc CachedConn) QueryWithCallbackExpireCtx(ctx context.Context, v interface
 	if callback == nil {
 		return cc.QueryCtx(ctx, v, key, query)
 	}
-	return cc.cache.SetWithExpireCtx(ctx, key, v, callback(v))
+	return cc.cacheOf().SetWithExpireCtx(ctx, key, v, callback(v))
 }
 
 func (cc CachedConn) aroundDuration(duration time.Duration) time.Duration {
@@ -238,17 +388,17 @@ func (cc CachedConn) aroundDuration(duration time.Duration) time.Duration {
 
 // SetCache sets v into cache with given key.
 func (cc CachedConn) SetCache(key string, v interface{}) error {
-	return cc.cache.SetCtx(context.Background(), key, v)
+	return cc.cacheOf().SetCtx(context.Background(), key, v)
 }
 
 // SetCacheCtx sets v into cache with given key.
 func (cc CachedConn) SetCacheCtx(ctx context.Context, key string, val interface{}) error {
-	return cc.cache.SetCtx(ctx, key, val)
+	return cc.cacheOf().SetCtx(ctx, key, val)
 }
 
 // SetCacheWithExpireCtx sets v into cache with given key.
 func (cc CachedConn) SetCacheWithExpireCtx(ctx context.Context, key string, val interface{}, expire time.Duration) error {
-	return cc.cache.SetWithExpireCtx(ctx, key, val, expire)
+	return cc.cacheOf().SetWithExpireCtx(ctx, key, val, expire)
 }
 
 // Transact runs given fn in transaction mode.
@@ -258,7 +408,12 @@ func (cc CachedConn) Transact(fn func(db *gorm.DB) error, opts ...*sql.TxOptions
 
 // TransactCtx runs given fn in transaction mode.
 func (cc CachedConn) TransactCtx(ctx context.Context, fn func(db *gorm.DB) error, opts ...*sql.TxOptions) error {
-	return cc.db.WithContext(ctx).Transaction(fn, opts...)
+	db, release, err := cc.dbOf(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return db.WithContext(ctx).Transaction(fn, opts...)
 }
 
 var sqlAttributeKey = attribute.Key("sql.method")
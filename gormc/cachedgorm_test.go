@@ -2,12 +2,14 @@ package gormc
 
 import (
 	"context"
+	"errors"
 	"github.com/zeromicro/go-zero/core/logx"
 	"github.com/zeromicro/go-zero/core/mathx"
 	"github.com/zeromicro/go-zero/core/stat"
 	"github.com/zeromicro/go-zero/core/stores/cache"
 	"github.com/zeromicro/go-zero/core/stores/redis"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"testing"
 	"time"
@@ -49,8 +51,7 @@ func TestGormc_QueryWithExpire(t *testing.T) {
 	}
 	db, err := gorm.Open(mysql.New(mcg))
 	if err != nil {
-		t.Error(err)
-		return
+		t.Skipf("mysql is not available: %v", err)
 	}
 	ccf := cache.CacheConf{
 		cache.NodeConf{
@@ -63,8 +64,8 @@ func TestGormc_QueryWithExpire(t *testing.T) {
 	}
 	gormc := NewConn(db, ccf)
 	var str string
-	err = gormc.QueryWithExpireCtx(context.Background(), &str, "any", time.Second*5, func(conn *gorm.DB, v interface{}) error {
-		*v.(*string) = "value"
+	err = gormc.QueryWithExpireCtx(context.Background(), &str, "any", time.Second*5, func(conn *gorm.DB) error {
+		str = "value"
 		return nil
 	})
 	if err != nil {
@@ -72,8 +73,8 @@ func TestGormc_QueryWithExpire(t *testing.T) {
 		return
 	}
 
-	err = gormc.QueryWithCallbackExpireCtx(context.Background(), &str, "any", func(conn *gorm.DB, v interface{}) error {
-		*v.(*string) = "value"
+	err = gormc.QueryWithCallbackExpireCtx(context.Background(), &str, "any", func(conn *gorm.DB) error {
+		str = "value"
 		return nil
 	}, func(i interface{}) time.Duration {
 		return time.Second * 5
@@ -91,3 +92,49 @@ func TestUnstable(t *testing.T) {
 	t.Logf("unstable: %v", unstable.AroundDuration(5*time.Minute))
 
 }
+
+type connTestUser struct {
+	Id   uint64 `gorm:"column:id;primaryKey"`
+	Name string `gorm:"column:name"`
+}
+
+func TestConn_NoCache(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&connTestUser{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := NewConnNoCache(db)
+	ctx := context.Background()
+	err = conn.ExecNoCacheCtx(ctx, func(conn *gorm.DB) error {
+		return conn.Create(&connTestUser{Id: 1, Name: "alice"}).Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rollback := errors.New("rollback")
+	err = conn.TransactCtx(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(&connTestUser{Id: 2, Name: "bob"}).Error; err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("expected rollback error, got %v", err)
+	}
+
+	var users []connTestUser
+	err = conn.QueryNoCacheCtx(ctx, func(conn *gorm.DB) error {
+		return conn.Find(&users).Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Name != "alice" {
+		t.Fatalf("unexpected users: %+v", users)
+	}
+}
@@ -15,6 +15,11 @@ type GormLogConfigI interface {
 }
 
 func NewDefaultZeroLogger(cfg GormLogConfigI) gormLogger.Interface {
+	return NewZeroLogger(cfg)
+}
+
+// NewZeroLogger returns the go-zero logger of cfg customized by opts, e.g. logger.WithStructured().
+func NewZeroLogger(cfg GormLogConfigI, opts ...logger.Option) gormLogger.Interface {
 	newLogger := logger.NewZeroLog(
 		gormLogger.Config{
 			SlowThreshold:             cfg.GetSlowThreshold(), // 慢 SQL 阈值
@@ -22,6 +27,7 @@ func NewDefaultZeroLogger(cfg GormLogConfigI) gormLogger.Interface {
 			IgnoreRecordNotFoundError: true,                   // 忽略ErrRecordNotFound（记录未找到）错误
 			Colorful:                  cfg.GetColorful(),      // 禁用彩色打印
 		},
+		opts...,
 	)
 	return newLogger
 }
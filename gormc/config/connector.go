@@ -0,0 +1,90 @@
+package config
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+)
+
+type (
+	// DsnFunc returns the current dsn, it is called for every new connection.
+	DsnFunc func(ctx context.Context) (string, error)
+
+	rotatingConnector struct {
+		driver    driver.Driver
+		dsn       DsnFunc
+		mu        sync.Mutex
+		current   string
+		connector driver.Connector
+	}
+
+	dsnConnector struct {
+		driver driver.Driver
+		dsn    string
+	}
+)
+
+// NewRotatingConnector returns a driver.Connector that opens new connections with the dsn returned by dsn,
+// so rotated credentials are used without restarting. Open connections are kept until they are closed,
+// set ConnMaxLifetime to bound how long they live.
+func NewRotatingConnector(d driver.Driver, dsn DsnFunc) driver.Connector {
+	return &rotatingConnector{
+		driver: d,
+		dsn:    dsn,
+	}
+}
+
+// SecretDsn returns a DsnFunc that formats the value of secret with dsn, e.g. a password into a dsn.
+func SecretDsn(secret *Secret, dsn func(value string) string) DsnFunc {
+	return func(ctx context.Context) (string, error) {
+		value, err := secret.Value(ctx)
+		if err != nil {
+			return "", err
+		}
+		return dsn(value), nil
+	}
+}
+
+func (c *rotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn, err := c.dsn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := c.connectorOf(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c *rotatingConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (c *rotatingConnector) connectorOf(dsn string) (driver.Connector, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.connector != nil && c.current == dsn {
+		return c.connector, nil
+	}
+
+	var connector driver.Connector = dsnConnector{driver: c.driver, dsn: dsn}
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		var err error
+		if connector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	c.current = dsn
+	c.connector = connector
+	return connector, nil
+}
+
+func (c dsnConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
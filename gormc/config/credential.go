@@ -0,0 +1,119 @@
+package config
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// Credential is the password of the primary or a replica of a DriverConf.
+	Credential struct {
+		Password     string                       // the password of the dsn
+		PasswordFrom string                       // the source of the password, see ResolveSecret
+		Dsn          func(password string) string // formats the dsn with a resolved password
+	}
+
+	// DriverConf is the config of a driver package, like mysql.Mysql, opened by Connect.
+	DriverConf interface {
+		Validate() error
+		// RegisterTLS registers the tls configs referenced by the dsns.
+		RegisterTLS() error
+		// DBConf returns the driver agnostic config, its PasswordRefresh applies to the credentials.
+		DBConf() DBConf
+		// Credentials returns the credentials of the primary and of the replicas of DBConf, in order.
+		Credentials() []Credential
+	}
+)
+
+// Connect opens d like Open. The passwords of the credentials with a PasswordFrom are resolved for
+// new connections and refreshed every PasswordRefresh, all passwords are redacted from the logs and errors.
+func Connect(d DriverConf, opts ...Option) (*gorm.DB, error) {
+	c, credentialOpts, passwords, err := prepare(d)
+	if err != nil {
+		return nil, err
+	}
+	db, err := Open(c, append(credentialOpts, opts...)...)
+	if err != nil {
+		return nil, RedactError(err, passwords()...)
+	}
+	return db, nil
+}
+
+// ConnectReloadable opens d like Connect, apply changes of d with Reload.
+func ConnectReloadable(d DriverConf, opts ...Option) (*ReloadableDB, error) {
+	c, credentialOpts, passwords, err := prepare(d)
+	if err != nil {
+		return nil, err
+	}
+	r, err := OpenReloadable(c, append(credentialOpts, opts...)...)
+	if err != nil {
+		return nil, RedactError(err, passwords()...)
+	}
+	return r, nil
+}
+
+// Reload applies d to r, e.g. in the callback of a ConfigWatcher.
+func Reload(r *ReloadableDB, d DriverConf) error {
+	c, credentialOpts, passwords, err := prepare(d)
+	if err != nil {
+		return err
+	}
+	if err = r.Reload(c, credentialOpts...); err != nil {
+		return RedactError(err, passwords()...)
+	}
+	return nil
+}
+
+// prepare validates d and registers its tls configs,
+// it returns the DBConf of d with the options and the passwords of its credentials.
+func prepare(d DriverConf) (DBConf, []Option, func() []string, error) {
+	if err := d.Validate(); err != nil {
+		return DBConf{}, nil, nil, err
+	}
+	if err := d.RegisterTLS(); err != nil {
+		return DBConf{}, nil, nil, err
+	}
+
+	c := d.DBConf()
+	opts, passwords := credentialOptions(d.Credentials(), c.PasswordRefresh)
+	return c, opts, passwords, nil
+}
+
+// credentialOptions resolves the passwords of credentials from PasswordFrom, one Secret per source,
+// and redacts them from the connect logs. credentials are the primary's followed by the replicas'.
+func credentialOptions(credentials []Credential, refresh time.Duration) ([]Option, func() []string) {
+	var (
+		secrets  = make(map[string]*Secret)
+		resolved []*Secret
+		dsnFuncs = make([]DsnFunc, len(credentials))
+	)
+	for i, credential := range credentials {
+		if len(credential.PasswordFrom) == 0 {
+			continue
+		}
+		secret, ok := secrets[credential.PasswordFrom]
+		if !ok {
+			secret = NewSecret(credential.PasswordFrom, refresh)
+			secrets[credential.PasswordFrom] = secret
+			resolved = append(resolved, secret)
+		}
+		dsnFuncs[i] = SecretDsn(secret, credential.Dsn)
+	}
+
+	passwords := func() []string {
+		passwords := make([]string, 0, len(credentials)+len(resolved))
+		for _, credential := range credentials {
+			passwords = append(passwords, credential.Password)
+		}
+		for _, secret := range resolved {
+			passwords = append(passwords, secret.Cached())
+		}
+		return passwords
+	}
+	opts := []Option{WithRedact(passwords)}
+	if len(resolved) > 0 {
+		opts = append(opts, WithDsnFunc(dsnFuncs[0], dsnFuncs[1:]...))
+	}
+	return opts, passwords
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// credentialTestConf is a DriverConf of passwordTestDriver with a replica.
+type credentialTestConf struct {
+	dir          string
+	passwordFrom string
+}
+
+func (c credentialTestConf) Validate() error {
+	return nil
+}
+
+func (c credentialTestConf) RegisterTLS() error {
+	return nil
+}
+
+func (c credentialTestConf) DBConf() DBConf {
+	return DBConf{
+		Driver:   passwordTestDriver,
+		Dsn:      filepath.Join(c.dir, "primary.db") + "|",
+		Replicas: []ReplicaConf{{Dsn: filepath.Join(c.dir, "replica.db") + "|"}},
+	}
+}
+
+func (c credentialTestConf) Credentials() []Credential {
+	credential := func(path string) Credential {
+		return Credential{
+			PasswordFrom: c.passwordFrom,
+			Dsn: func(password string) string {
+				return filepath.Join(c.dir, path) + "|" + password
+			},
+		}
+	}
+	return []Credential{credential("primary.db"), credential("replica.db")}
+}
+
+func TestConnect_Credentials(t *testing.T) {
+	t.Setenv("GORM_ZERO_TEST_CREDENTIAL", "s3cret")
+	d := credentialTestConf{dir: t.TempDir(), passwordFrom: "env:GORM_ZERO_TEST_CREDENTIAL"}
+	db, err := Connect(d, WithStdLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB(db)
+	if err = PingDB(context.Background(), db); err != nil {
+		t.Fatalf("expected the primary and the replica to use the resolved password, got %v", err)
+	}
+
+	r, err := ConnectReloadable(d, WithStdLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB(r.DB())
+	if err = Reload(r, d); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GORM_ZERO_TEST_CREDENTIAL", "hunter2")
+	_, err = Connect(d, WithStdLogger())
+	if err == nil || !strings.Contains(err.Error(), "access denied") || strings.Contains(err.Error(), "hunter2") {
+		t.Fatalf("expected a redacted access denied error, got %v", err)
+	}
+}
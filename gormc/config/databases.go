@@ -0,0 +1,183 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+type (
+	// Databases are named database configs, to be embedded in a go-zero config, e.g.
+	//
+	//	type Config struct {
+	//		rest.RestConf
+	//		Databases config.Databases
+	//	}
+	//
+	// Passwords can be kept out of the dsns with PasswordFrom, if the driver registered a DsnPassword.
+	Databases map[string]DBConf
+
+	// DatabaseRegistry holds the opened connections of Databases.
+	DatabaseRegistry struct {
+		dbs   map[string]*gorm.DB
+		names []string
+	}
+)
+
+// Validate reports every invalid field of every database.
+func (d Databases) Validate() error {
+	var errs []error
+	for _, name := range d.names() {
+		c := d[name]
+		if err := c.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("database %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Open opens every database concurrently with the shared opts.
+// If any fails, the opened ones are closed and the errors of all failed ones are returned.
+func (d Databases) Open(opts ...Option) (*DatabaseRegistry, error) {
+	r := &DatabaseRegistry{
+		dbs:   make(map[string]*gorm.DB, len(d)),
+		names: d.names(),
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs []error
+	)
+	for _, name := range r.names {
+		wg.Add(1)
+		go func(name string, c DBConf) {
+			defer wg.Done()
+			db, err := Open(c, opts...)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("open database %s: %w", name, c.redactError(err)))
+				return
+			}
+			r.dbs[name] = db
+		}(name, d[name])
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		_ = r.Close()
+		return nil, errors.Join(errs...)
+	}
+	return r, nil
+}
+
+func (d Databases) names() []string {
+	names := make([]string, 0, len(d))
+	for name := range d {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Names returns the names of the databases in order.
+func (r *DatabaseRegistry) Names() []string {
+	return r.names
+}
+
+// Get returns the database of name.
+func (r *DatabaseRegistry) Get(name string) (*gorm.DB, bool) {
+	db, ok := r.dbs[name]
+	return db, ok
+}
+
+// MustGet returns the database of name, it panics if there is none.
+func (r *DatabaseRegistry) MustGet(name string) *gorm.DB {
+	db, ok := r.dbs[name]
+	if !ok {
+		panic(fmt.Sprintf("database %s is not configured", name))
+	}
+	return db
+}
+
+// Ping pings every database and its replicas, it reports all that are not ready.
+func (r *DatabaseRegistry) Ping(ctx context.Context) error {
+	var errs []error
+	r.each(func(name string, db *sql.DB) {
+		if err := db.PingContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("ping database %s: %w", name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Close closes the connection pools of every database and its replicas.
+func (r *DatabaseRegistry) Close() error {
+	var errs []error
+	r.each(func(name string, db *sql.DB) {
+		if err := db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close database %s: %w", name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// CloseDB closes the connection pools of db and its replicas.
+func CloseDB(db *gorm.DB) error {
+	r := DatabaseRegistry{
+		dbs:   map[string]*gorm.DB{"": db},
+		names: []string{""},
+	}
+	return r.Close()
+}
+
+// PingDB pings db and its replicas.
+func PingDB(ctx context.Context, db *gorm.DB) error {
+	r := DatabaseRegistry{
+		dbs:   map[string]*gorm.DB{"primary": db},
+		names: []string{"primary"},
+	}
+	return r.Ping(ctx)
+}
+
+func (r *DatabaseRegistry) each(fn func(name string, db *sql.DB)) {
+	for _, name := range r.names {
+		db, ok := r.dbs[name]
+		if !ok {
+			continue
+		}
+		if sqldb, err := db.DB(); err == nil {
+			fn(name, sqldb)
+		}
+
+		pool := ReplicasOf(db)
+		if pool == nil {
+			continue
+		}
+		for i, replica := range pool.Names() {
+			conn, err := pool.Conn(i)
+			if err != nil {
+				continue
+			}
+			if sqldb, ok := sqlDBOf(conn); ok {
+				fn(name+"/"+replica, sqldb)
+			}
+		}
+	}
+}
+
+// sqlDBOf returns the *sql.DB of conn.
+func sqlDBOf(conn gorm.ConnPool) (*sql.DB, bool) {
+	if connector, ok := conn.(gorm.GetDBConnector); ok {
+		sqldb, err := connector.GetDBConn()
+		return sqldb, err == nil && sqldb != nil
+	}
+	sqldb, ok := conn.(*sql.DB)
+	return sqldb, ok
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/zeromicro/go-zero/core/conf"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// passwordTestDriver is sqlite with dsns formatted as path|password, it accepts the password s3cret only.
+const passwordTestDriver = "sqlite-password-test"
+
+func init() {
+	RegisterDriver(passwordTestDriver, func(dsn string) gorm.Dialector {
+		path, password, _ := strings.Cut(dsn, "|")
+		if password != "s3cret" {
+			return failingDialector{err: fmt.Errorf("access denied for %s", dsn)}
+		}
+		return sqlite.Open(path)
+	})
+	RegisterConnDriver(passwordTestDriver, passwordTestConnDriver{}, func(conn gorm.ConnPool, dsn string) gorm.Dialector {
+		return &sqlite.Dialector{DSN: dsn, Conn: conn}
+	})
+	RegisterDsnPassword(passwordTestDriver, passwordTestDsn{})
+}
+
+type (
+	passwordTestConnDriver struct{}
+	passwordTestDsn        struct{}
+)
+
+func (passwordTestConnDriver) Open(dsn string) (driver.Conn, error) {
+	path, password, _ := strings.Cut(dsn, "|")
+	if password != "s3cret" {
+		return nil, fmt.Errorf("access denied for %s", dsn)
+	}
+	return (&sqlite3.SQLiteDriver{}).Open(path)
+}
+
+func (passwordTestDsn) Password(dsn string) (string, error) {
+	_, password, _ := strings.Cut(dsn, "|")
+	return password, nil
+}
+
+func (passwordTestDsn) WithPassword(dsn, password string) (string, error) {
+	path, _, _ := strings.Cut(dsn, "|")
+	return path + "|" + password, nil
+}
+
+func TestDatabases(t *testing.T) {
+	dir := t.TempDir()
+	yaml := fmt.Sprintf(`
+Databases:
+  orders:
+    Driver: %s
+    Dsn: %s
+  reporting:
+    Driver: %s
+    Dsn: %s
+    MaxOpenConns: 2
+`, testDriver, filepath.Join(dir, "orders.db"), testDriver, filepath.Join(dir, "reporting.db"))
+	var c struct {
+		Databases Databases
+	}
+	if err := conf.LoadFromYamlBytes([]byte(yaml), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Databases["orders"].MaxOpenConns != 10 {
+		t.Fatalf("expected defaults to apply, got %+v", c.Databases["orders"])
+	}
+	if err := c.Databases.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.Databases.Open(WithStdLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(r.Names(), ",") != "orders,reporting" {
+		t.Fatalf("unexpected names %v", r.Names())
+	}
+	reporting, ok := r.Get("reporting")
+	if !ok {
+		t.Fatal("expected reporting database")
+	}
+	sqldb, _ := reporting.DB()
+	if sqldb.Stats().MaxOpenConnections != 2 {
+		t.Fatal("expected the reporting pool size")
+	}
+	if _, ok = r.Get("billing"); ok {
+		t.Fatal("expected no billing database")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected MustGet to panic")
+			}
+		}()
+		r.MustGet("billing")
+	}()
+
+	if err = r.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Ping(context.Background()); err == nil || !strings.Contains(err.Error(), "orders") ||
+		!strings.Contains(err.Error(), "reporting") {
+		t.Fatalf("expected both databases to be closed, got %v", err)
+	}
+}
+
+func TestDatabases_PasswordFrom(t *testing.T) {
+	t.Setenv("GORM_ZERO_TEST_DB_PASSWORD", "s3cret")
+	dir := t.TempDir()
+	d := Databases{
+		"orders":  {Driver: passwordTestDriver, Dsn: filepath.Join(dir, "orders.db"), PasswordFrom: "env:GORM_ZERO_TEST_DB_PASSWORD"},
+		"billing": {Driver: passwordTestDriver, Dsn: filepath.Join(dir, "billing.db") + "|s3cret"},
+	}
+	if err := d.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.Open(WithStdLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err = r.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	unsupported := Databases{"users": {Driver: testDriver, Dsn: "x", PasswordFrom: "env:GORM_ZERO_TEST_DB_PASSWORD"}}
+	if err = unsupported.Validate(); err == nil || !strings.Contains(err.Error(), "does not support PasswordFrom") {
+		t.Fatalf("expected PasswordFrom to be unsupported, got %v", err)
+	}
+}
+
+func TestDatabases_OpenErrorRedacted(t *testing.T) {
+	t.Setenv("GORM_ZERO_TEST_DB_PASSWORD", "hunter3")
+	dir := t.TempDir()
+	d := Databases{
+		"orders":  {Driver: passwordTestDriver, Dsn: filepath.Join(dir, "orders.db") + "|hunter2"},
+		"billing": {Driver: passwordTestDriver, Dsn: filepath.Join(dir, "billing.db"), PasswordFrom: "env:GORM_ZERO_TEST_DB_PASSWORD"},
+	}
+	_, err := d.Open(WithStdLogger())
+	if err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Fatalf("expected access denied, got %v", err)
+	}
+	if strings.Contains(err.Error(), "hunter2") || strings.Contains(err.Error(), "hunter3") {
+		t.Fatalf("expected passwords to be redacted, got %v", err)
+	}
+}
+
+func TestDatabases_OpenError(t *testing.T) {
+	dir := t.TempDir()
+	d := Databases{
+		"orders":  {Driver: testDriver, Dsn: filepath.Join(dir, "orders.db")},
+		"missing": {Driver: testDriver, Dsn: filepath.Join(dir, "missing", "x.db")},
+		"unknown": {Driver: "oracle", Dsn: "x"},
+	}
+	if err := d.Validate(); err == nil || !strings.Contains(err.Error(), "database unknown") {
+		t.Fatalf("expected unknown driver error, got %v", err)
+	}
+
+	_, err := d.Open(WithStdLogger())
+	if err == nil || !strings.Contains(err.Error(), "open database missing") ||
+		!strings.Contains(err.Error(), "open database unknown") {
+		t.Fatalf("expected errors of both failed databases, got %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/metric"
+)
+
+const (
+	defaultLagThreshold     = 30 * time.Second
+	defaultLagCheckInterval = 5 * time.Second
+	defaultLagCheckTimeout  = 3 * time.Second
+
+	mysqlReplicaStatusSql = "SHOW REPLICA STATUS"
+	mysqlSlaveStatusSql   = "SHOW SLAVE STATUS"
+	pgReplicaLagSql       = "SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0 " +
+		"ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()) END"
+)
+
+// ErrReplicationStopped is returned by lag sources when a replica does not replicate.
+var ErrReplicationStopped = errors.New("replication is not running")
+
+var (
+	metricReplicaLag = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: "gorm",
+		Subsystem: "replica",
+		Name:      "lag_seconds",
+		Help:      "gorm replica replication lag in seconds.",
+		Labels:    []string{"db", "replica"},
+	})
+	metricReplicaHealthy = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: "gorm",
+		Subsystem: "replica",
+		Name:      "healthy",
+		Help:      "gorm replica is in the read pool (1) or evicted (0).",
+		Labels:    []string{"db", "replica"},
+	})
+)
+
+type (
+	// LagSource measures the replication lag of the i-th replica of a ReplicaPool.
+	LagSource interface {
+		Lag(ctx context.Context, replica int) (time.Duration, error)
+	}
+
+	// LagSourceFunc is an adapter to allow the use of ordinary functions as LagSource.
+	LagSourceFunc func(ctx context.Context, replica int) (time.Duration, error)
+
+	// LagCheckerOption customizes a LagChecker.
+	LagCheckerOption func(c *LagChecker)
+
+	// LagChecker evicts replicas that lag behind the threshold from the read pool,
+	// and adds them back once they catch up. It implements go-zero's service.Service.
+	LagChecker struct {
+		name      string
+		pool      *ReplicaPool
+		source    LagSource
+		threshold time.Duration
+		interval  time.Duration
+		timeout   time.Duration
+
+		ctx      context.Context
+		cancel   context.CancelFunc
+		stopOnce sync.Once
+	}
+
+	mysqlLagSource struct {
+		pool *ReplicaPool
+	}
+
+	pgLagSource struct {
+		pool *ReplicaPool
+	}
+)
+
+// Lag calls f(ctx, replica).
+func (f LagSourceFunc) Lag(ctx context.Context, replica int) (time.Duration, error) {
+	return f(ctx, replica)
+}
+
+// NewMysqlLagSource returns a LagSource that reads Seconds_Behind_Source of the replicas in pool.
+func NewMysqlLagSource(pool *ReplicaPool) LagSource {
+	return mysqlLagSource{pool: pool}
+}
+
+// NewPgLagSource returns a LagSource based on pg_last_xact_replay_timestamp of the replicas in pool.
+func NewPgLagSource(pool *ReplicaPool) LagSource {
+	return pgLagSource{pool: pool}
+}
+
+// NewLagChecker returns a LagChecker of pool, name labels the metrics.
+func NewLagChecker(name string, pool *ReplicaPool, source LagSource, opts ...LagCheckerOption) *LagChecker {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &LagChecker{
+		name:      name,
+		pool:      pool,
+		source:    source,
+		threshold: defaultLagThreshold,
+		interval:  defaultLagCheckInterval,
+		timeout:   defaultLagCheckTimeout,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithLagThreshold sets the lag above which a replica is evicted.
+func WithLagThreshold(threshold time.Duration) LagCheckerOption {
+	return func(c *LagChecker) {
+		if threshold > 0 {
+			c.threshold = threshold
+		}
+	}
+}
+
+// WithLagCheckInterval sets the interval between two checks.
+func WithLagCheckInterval(interval time.Duration) LagCheckerOption {
+	return func(c *LagChecker) {
+		if interval > 0 {
+			c.interval = interval
+		}
+	}
+}
+
+// Start checks the replicas until Stop is called.
+func (c *LagChecker) Start() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.CheckOnce(c.ctx)
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the checker.
+func (c *LagChecker) Stop() {
+	c.stopOnce.Do(c.cancel)
+}
+
+// CheckOnce measures every replica once and updates the read pool.
+func (c *LagChecker) CheckOnce(ctx context.Context) {
+	for i, name := range c.pool.Names() {
+		checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		lag, err := c.source.Lag(checkCtx, i)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		switch {
+		case err != nil:
+			c.evict(i, name, fmt.Sprintf("lag check failed: %v", err))
+		case lag > c.threshold:
+			metricReplicaLag.Set(lag.Seconds(), c.name, name)
+			c.evict(i, name, fmt.Sprintf("lag %v exceeds %v", lag, c.threshold))
+		default:
+			metricReplicaLag.Set(lag.Seconds(), c.name, name)
+			if !c.pool.Healthy(i) {
+				logx.Infof("replica %s of %s recovered with lag %v, restored to the read pool", name, c.name, lag)
+			}
+			c.pool.Restore(i)
+			metricReplicaHealthy.Set(1, c.name, name)
+		}
+	}
+}
+
+func (c *LagChecker) evict(i int, name, reason string) {
+	if c.pool.Healthy(i) {
+		logx.Errorf("replica %s of %s is evicted from the read pool: %s", name, c.name, reason)
+	}
+	c.pool.Evict(i)
+	metricReplicaHealthy.Set(0, c.name, name)
+}
+
+func (s mysqlLagSource) Lag(ctx context.Context, replica int) (time.Duration, error) {
+	conn, err := s.pool.Conn(replica)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := conn.QueryContext(ctx, mysqlReplicaStatusSql)
+	if err != nil {
+		// MySQL before 8.0.22 only knows SHOW SLAVE STATUS.
+		rows, err = conn.QueryContext(ctx, mysqlSlaveStatusSql)
+		if err != nil {
+			return 0, err
+		}
+	}
+	defer rows.Close()
+
+	status, err := scanRowToMap(rows)
+	if err != nil {
+		return 0, err
+	}
+	return parseMysqlLag(status)
+}
+
+func (s pgLagSource) Lag(ctx context.Context, replica int) (time.Duration, error) {
+	conn, err := s.pool.Conn(replica)
+	if err != nil {
+		return 0, err
+	}
+
+	var seconds sql.NullFloat64
+	if err = conn.QueryRowContext(ctx, pgReplicaLagSql).Scan(&seconds); err != nil {
+		return 0, err
+	}
+	if !seconds.Valid {
+		return 0, ErrReplicationStopped
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
+
+func parseMysqlLag(status map[string]string) (time.Duration, error) {
+	if status == nil {
+		return 0, ErrReplicationStopped
+	}
+	for _, column := range []string{"Seconds_Behind_Source", "Seconds_Behind_Master"} {
+		v, ok := status[column]
+		if !ok {
+			continue
+		}
+		if len(v) == 0 {
+			// NULL means the SQL thread is not running.
+			return 0, ErrReplicationStopped
+		}
+		seconds, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("replica status has no seconds behind source")
+}
+
+// scanRowToMap reads the first row of rows, NULL columns become empty strings.
+func scanRowToMap(rows *sql.Rows) (map[string]string, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]string, len(columns))
+	for i, column := range columns {
+		res[column] = string(values[i])
+	}
+	return res, nil
+}
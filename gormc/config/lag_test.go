@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+)
+
+func TestLagChecker(t *testing.T) {
+	db, pool := createReplicatedDB(t, 100)
+	ctx := context.Background()
+
+	var (
+		lag    time.Duration
+		lagErr error
+	)
+	source := LagSourceFunc(func(ctx context.Context, replica int) (time.Duration, error) {
+		return lag, lagErr
+	})
+	checker := NewLagChecker("test", pool, source, WithLagThreshold(10*time.Second))
+
+	lag = time.Second
+	checker.CheckOnce(ctx)
+	if !pool.Healthy(0) || findName(t, db) != "replica" {
+		t.Fatal("expected replica to serve reads")
+	}
+
+	lag = time.Minute
+	checker.CheckOnce(ctx)
+	if pool.Healthy(0) {
+		t.Fatal("expected lagging replica to be evicted")
+	}
+	if name := findName(t, db); name != "primary" {
+		t.Fatalf("expected reads to fall back to primary, got %s", name)
+	}
+
+	lag = 0
+	checker.CheckOnce(ctx)
+	if !pool.Healthy(0) || findName(t, db) != "replica" {
+		t.Fatal("expected recovered replica to serve reads again")
+	}
+
+	lagErr = errors.New("connection refused")
+	checker.CheckOnce(ctx)
+	if pool.Healthy(0) {
+		t.Fatal("expected unreachable replica to be evicted")
+	}
+}
+
+func TestReplicaPool_Conn(t *testing.T) {
+	_, pool := createReplicatedDB(t, 100)
+	conn, err := pool.Conn(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err = conn.QueryRowContext(context.Background(),
+		"SELECT name FROM replica_test_users WHERE id = 1").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "replica" {
+		t.Fatalf("expected replica connection, got %s", name)
+	}
+	if _, err = pool.Conn(1); err == nil {
+		t.Fatal("expected out of range error")
+	}
+
+	// each index is the connection of the replica registered at it.
+	dir := t.TempDir()
+	db := openSqlite(t, filepath.Join(dir, "primary.db"), "primary")
+	var replicas []ReplicaDialector
+	for _, name := range []string{"first", "second", "third"} {
+		path := filepath.Join(dir, name+".db")
+		openSqlite(t, path, name)
+		replicas = append(replicas, ReplicaDialector{Name: name, Dialector: sqlite.Open(path), Weight: 1})
+	}
+	if pool, err = UseReplicas(db, replicas); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range pool.Names() {
+		if conn, err = pool.Conn(i); err != nil {
+			t.Fatal(err)
+		}
+		if err = conn.QueryRowContext(context.Background(),
+			"SELECT name FROM replica_test_users WHERE id = 1").Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		if name != want {
+			t.Fatalf("expected the connection of %s at %d, got %s", want, i, name)
+		}
+	}
+}
+
+func TestParseMysqlLag(t *testing.T) {
+	cases := []struct {
+		name   string
+		status map[string]string
+		lag    time.Duration
+		err    bool
+	}{
+		{name: "source", status: map[string]string{"Seconds_Behind_Source": "3"}, lag: 3 * time.Second},
+		{name: "master", status: map[string]string{"Seconds_Behind_Master": "0"}, lag: 0},
+		{name: "stopped", status: map[string]string{"Seconds_Behind_Source": ""}, err: true},
+		{name: "not a replica", status: nil, err: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			lag, err := parseMysqlLag(c.status)
+			if (err != nil) != c.err || lag != c.lag {
+				t.Fatalf("got %v %v", lag, err)
+			}
+		})
+	}
+}
@@ -4,83 +4,263 @@ import (
 	"errors"
 	"fmt"
 	"github.com/SpectatorNan/gorm-zero/gormc/config"
-	"github.com/SpectatorNan/gorm-zero/gormc/plugins"
+	mysqlDriver "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
-type Mysql struct {
-	Path          string // 服务器地址
-	Port          int    `json:",default=3306"`                                               // 端口
-	Config        string `json:",default=charset%3Dutf8mb4%26parseTime%3Dtrue%26loc%3DLocal"` // 高级配置
-	Dbname        string // 数据库名
-	Username      string // 数据库用户名
-	Password      string // 数据库密码
-	MaxIdleConns  int    `json:",default=10"` // 空闲中的最大连接数
-	MaxOpenConns  int    `json:",default=10"` // 打开到数据库的最大连接数
-	LogMode       string `json:",default=dev,options=dev|test|prod|silent"`
-	LogColorful   bool   `json:",default=false"` // 是否开启日志高亮
-	SlowThreshold int64  `json:",default=1000"`
+// DriverName is the name mysql is registered with in config.RegisterDriver.
+const DriverName = "mysql"
+
+func init() {
+	config.RegisterDriver(DriverName, func(dsn string) gorm.Dialector {
+		return mysql.New(mysql.Config{DSN: dsn})
+	})
+	config.RegisterConnDriver(DriverName, &mysqlDriver.MySQLDriver{}, func(conn gorm.ConnPool, dsn string) gorm.Dialector {
+		return mysql.New(mysql.Config{DSN: dsn, Conn: conn})
+	})
+	config.RegisterDsnPassword(DriverName, dsnPassword{})
 }
 
-func (m *Mysql) Dsn() string {
-	return m.Username + ":" + m.Password + "@tcp(" + m.Path + ":" + fmt.Sprintf("%d", m.Port) + ")/" + m.Dbname + "?" + m.Config
+// dsnPassword reads and replaces the password of mysql dsns.
+type dsnPassword struct{}
+
+func (dsnPassword) Password(dsn string) (string, error) {
+	cfg, err := mysqlDriver.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	return cfg.Passwd, nil
 }
 
-func (m *Mysql) GetGormLogMode() logger.LogLevel {
-	return config.OverwriteGormLogMode(m.LogMode)
+func (dsnPassword) WithPassword(dsn, password string) (string, error) {
+	cfg, err := mysqlDriver.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	cfg.Passwd = password
+	return cfg.FormatDSN(), nil
 }
 
-func (m *Mysql) GetSlowThreshold() time.Duration {
-	return time.Duration(m.SlowThreshold) * time.Millisecond
+type Mysql struct {
+	Path            string           // 服务器地址
+	Port            int              `json:",default=3306"`                                               // 端口
+	Config          string           `json:",default=charset%3Dutf8mb4%26parseTime%3Dtrue%26loc%3DLocal"` // 高级配置
+	Dbname          string           // 数据库名
+	Username        string           // 数据库用户名
+	Password        string           // 数据库密码
+	PasswordFrom    string           `json:",optional"`    // 密码来源, 如 env:DB_PASSWORD, file:/path
+	PasswordRefresh time.Duration    `json:",default=5m"`  // 密码来源的刷新间隔
+	MaxIdleConns    int              `json:",default=10"`  // 空闲中的最大连接数
+	MaxOpenConns    int              `json:",default=10"`  // 打开到数据库的最大连接数
+	ConnMaxLifetime time.Duration    `json:",default=1h"`  // 连接可复用的最大时间
+	ConnMaxIdleTime time.Duration    `json:",default=10m"` // 连接最大空闲时间
+	LogMode         string           `json:",default=dev,options=dev|test|prod|silent"`
+	LogColorful     bool             `json:",default=false"` // 是否开启日志高亮
+	SlowThreshold   int64            `json:",default=1000"`
+	Replicas        []config.Replica `json:",optional"` // 只读副本
+	TLS             config.TLS       `json:",optional"` // TLS 配置
 }
-func (m *Mysql) GetColorful() bool {
-	return m.LogColorful
+
+func (m *Mysql) Dsn() string {
+	cfg, err := m.dsnConfig()
+	if err != nil {
+		// Validate reports the invalid Config.
+		cfg, _ = mysqlDriver.ParseDSN("/")
+		m.fillDsnConfig(cfg)
+	}
+	return cfg.FormatDSN()
 }
 
-func Connect(m Mysql) (*gorm.DB, error) {
-	if m.Dbname == "" {
-		return nil, errors.New("database name is empty")
+// RedactedDsn returns the dsn of m with the password redacted, for logging.
+func (m *Mysql) RedactedDsn() string {
+	redacted := *m
+	if len(redacted.Password) > 0 {
+		redacted.Password = config.RedactedPassword
 	}
-	mysqlCfg := mysql.Config{
-		DSN: m.Dsn(),
+	return redacted.Dsn()
+}
+
+// Validate reports every invalid field of m. An empty Path or Username is left to the driver defaults.
+func (m *Mysql) Validate() error {
+	var errs []error
+	if m.Port <= 0 || m.Port > 65535 {
+		errs = append(errs, fmt.Errorf("mysql Port %d is out of range", m.Port))
 	}
-	newLogger := config.NewDefaultGormLogger(&m)
-	db, err := gorm.Open(mysql.New(mysqlCfg), &gorm.Config{
-		Logger: newLogger,
-	})
+	if len(m.Dbname) == 0 {
+		errs = append(errs, errors.New("mysql Dbname is empty"))
+	}
+	if _, err := m.dsnConfig(); err != nil {
+		errs = append(errs, fmt.Errorf("mysql Config is invalid: %w", err))
+	}
+	if err := m.TLS.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	for i, r := range m.Replicas {
+		if err := r.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("mysql Replicas[%d]: %w", i, err))
+		}
+	}
+	c := m.DBConf()
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// dsnConfig returns the driver config of m, so the driver escapes the dsn.
+func (m *Mysql) dsnConfig() (*mysqlDriver.Config, error) {
+	params := m.Config
+	// go-zero defaults can't contain = and &, so the default Config is url escaped.
+	if !strings.Contains(params, "=") {
+		if unescaped, err := url.QueryUnescape(params); err == nil {
+			params = unescaped
+		}
+	}
+	cfg, err := mysqlDriver.ParseDSN("/?" + params)
 	if err != nil {
 		return nil, err
-	} else {
-		sqldb, _ := db.DB()
-		sqldb.SetMaxIdleConns(m.MaxIdleConns)
-		sqldb.SetMaxOpenConns(m.MaxOpenConns)
-		return db, nil
 	}
+	m.fillDsnConfig(cfg)
+	return cfg, nil
 }
 
-func ConnectWithConfig(m Mysql, cfg *gorm.Config) (*gorm.DB, error) {
-	if m.Dbname == "" {
-		return nil, errors.New("database name is empty")
+func (m *Mysql) fillDsnConfig(cfg *mysqlDriver.Config) {
+	cfg.User = m.Username
+	cfg.Passwd = m.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(m.Path, strconv.Itoa(m.Port))
+	cfg.DBName = m.Dbname
+	if m.TLS.Enabled() {
+		cfg.TLSConfig = m.tlsName()
 	}
-	mysqlCfg := mysql.Config{
-		DSN: m.Dsn(),
+}
+
+// RegisterTLS registers the tls.Config of m and its replicas with the mysql driver,
+// under the names referenced by their Dsn. Connect calls it.
+func (m *Mysql) RegisterTLS() error {
+	if !m.TLS.Enabled() {
+		return nil
 	}
-	db, err := gorm.Open(mysql.New(mysqlCfg), cfg)
-	if err != nil {
-		return nil, err
+	if err := m.registerTLS(); err != nil {
+		return err
 	}
+	for _, r := range m.Replicas {
+		replica := m.replica(r)
+		if err := replica.registerTLS(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	err = plugins.InitPlugins(db)
+func (m *Mysql) registerTLS() error {
+	cfg, err := m.TLS.BuildTLSConfig(m.Path)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	return mysqlDriver.RegisterTLSConfig(m.tlsName(), cfg)
+}
+
+func (m *Mysql) tlsName() string {
+	return fmt.Sprintf("gorm-zero-%s-%d", m.Path, m.Port)
+}
+
+func (m *Mysql) replica(r config.Replica) Mysql {
+	replica := *m
+	replica.Path = r.Path
+	if r.Port > 0 {
+		replica.Port = r.Port
+	}
+	if len(r.Username) > 0 {
+		replica.Username = r.Username
+		replica.Password = r.Password
+		replica.PasswordFrom = r.PasswordFrom
+	}
+	return replica
+}
+
+// Credentials returns the credentials of m and its replicas, for config.Connect.
+func (m *Mysql) Credentials() []config.Credential {
+	credential := func(c Mysql) config.Credential {
+		return config.Credential{
+			Password:     c.Password,
+			PasswordFrom: c.PasswordFrom,
+			Dsn: func(password string) string {
+				withPassword := c
+				withPassword.Password = password
+				return withPassword.Dsn()
+			},
+		}
+	}
+
+	credentials := []config.Credential{credential(*m)}
+	for _, r := range m.Replicas {
+		credentials = append(credentials, credential(m.replica(r)))
+	}
+	return credentials
+}
+
+// DBConf returns the driver agnostic config of m.
+func (m *Mysql) DBConf() config.DBConf {
+	c := config.DBConf{
+		Driver:          DriverName,
+		Dsn:             m.Dsn(),
+		MaxIdleConns:    m.MaxIdleConns,
+		MaxOpenConns:    m.MaxOpenConns,
+		ConnMaxLifetime: m.ConnMaxLifetime,
+		ConnMaxIdleTime: m.ConnMaxIdleTime,
+		LogMode:         m.LogMode,
+		LogColorful:     m.LogColorful,
+		SlowThreshold:   m.SlowThreshold,
+		PasswordRefresh: m.PasswordRefresh,
+	}
+	for _, r := range m.Replicas {
+		replica := m.replica(r)
+		c.Replicas = append(c.Replicas, config.ReplicaConf{
+			Name:   fmt.Sprintf("%s:%d", replica.Path, replica.Port),
+			Dsn:    replica.Dsn(),
+			Weight: r.Weight,
+		})
 	}
+	return c
+}
+
+func (m *Mysql) GetGormLogMode() logger.LogLevel {
+	return config.OverwriteGormLogMode(m.LogMode)
+}
+
+func (m *Mysql) GetSlowThreshold() time.Duration {
+	return time.Duration(m.SlowThreshold) * time.Millisecond
+}
+func (m *Mysql) GetColorful() bool {
+	return m.LogColorful
+}
 
-	sqldb, _ := db.DB()
-	sqldb.SetMaxIdleConns(m.MaxIdleConns)
-	sqldb.SetMaxOpenConns(m.MaxOpenConns)
-	return db, nil
+// Connect opens m, by default with the go-zero logger and the tracing plugin.
+func Connect(m Mysql, opts ...config.Option) (*gorm.DB, error) {
+	return config.Connect(&m, opts...)
+}
 
+// ConnectWithConfig opens m with cfg as the base gorm config.
+func ConnectWithConfig(m Mysql, cfg *gorm.Config, opts ...config.Option) (*gorm.DB, error) {
+	return Connect(m, append([]config.Option{config.WithGormConfig(cfg)}, opts...)...)
 }
+
+// ConnectReloadable opens m like Connect, apply changes of m with Reload.
+func ConnectReloadable(m Mysql, opts ...config.Option) (*config.ReloadableDB, error) {
+	return config.ConnectReloadable(&m, opts...)
+}
+
+// Reload applies m to r, e.g. in the callback of a config.ConfigWatcher.
+func Reload(r *config.ReloadableDB, m Mysql) error {
+	return config.Reload(r, &m)
+}
+
+var _ config.DriverConf = (*Mysql)(nil)
@@ -0,0 +1,220 @@
+package mysql
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/config"
+	"github.com/SpectatorNan/gorm-zero/gormc/config/internal/certtest"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+)
+
+func TestMysql_TLS(t *testing.T) {
+	files := certtest.Generate(t)
+	m := Mysql{
+		Path:     "127.0.0.1",
+		Port:     3306,
+		Config:   "charset=utf8mb4",
+		Dbname:   "gormzero",
+		Username: "root",
+		Password: "secret",
+		Replicas: []config.Replica{{Path: "localhost"}},
+		TLS: config.TLS{
+			Mode:     config.TLSVerifyFull,
+			CaFile:   files.CaFile,
+			CertFile: files.ClientCertFile,
+			KeyFile:  files.ClientKeyFile,
+		},
+	}
+	if err := m.RegisterTLS(); err != nil {
+		t.Fatal(err)
+	}
+
+	dsn := m.Dsn()
+	if !strings.HasSuffix(dsn, "?charset=utf8mb4&tls=gorm-zero-127.0.0.1-3306") {
+		t.Fatalf("unexpected dsn %s", dsn)
+	}
+	cfg, err := mysqlDriver.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLS == nil || cfg.TLS.ServerName != "127.0.0.1" || len(cfg.TLS.Certificates) != 1 {
+		t.Fatalf("unexpected tls config %+v", cfg.TLS)
+	}
+
+	replica := m.DBConf().Replicas[0]
+	cfg, err = mysqlDriver.ParseDSN(replica.Dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLS == nil || cfg.TLS.ServerName != "localhost" {
+		t.Fatalf("unexpected replica tls config %+v", cfg.TLS)
+	}
+
+	m.TLS.ServerName = "db.internal"
+	if err = m.RegisterTLS(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = mysqlDriver.ParseDSN(m.Dsn()); err != nil || cfg.TLS.ServerName != "db.internal" {
+		t.Fatalf("expected the server name to be verified, got %+v %v", cfg, err)
+	}
+}
+
+func TestMysql_TLSDisabled(t *testing.T) {
+	m := Mysql{Path: "127.0.0.1", Port: 3306, Dbname: "gormzero"}
+	if err := m.RegisterTLS(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(m.Dsn(), "tls=") {
+		t.Fatalf("unexpected tls in dsn %s", m.Dsn())
+	}
+
+	m.TLS = config.TLS{Mode: config.TLSVerifyCA, CaFile: "missing.pem"}
+	if _, err := Connect(m); err == nil {
+		t.Fatal("expected tls error")
+	}
+}
+
+func TestMysql_PasswordFrom(t *testing.T) {
+	t.Setenv("GORM_ZERO_MYSQL_PASSWORD", "primary-secret")
+	t.Setenv("GORM_ZERO_MYSQL_REPLICA_PASSWORD", "replica-secret")
+	m := Mysql{
+		Path:         "127.0.0.1",
+		Port:         3306,
+		Dbname:       "gormzero",
+		Username:     "root",
+		PasswordFrom: "env:GORM_ZERO_MYSQL_PASSWORD",
+		Replicas: []config.Replica{
+			{Path: "replica1"},
+			{Path: "replica2", Username: "reader", PasswordFrom: "env:GORM_ZERO_MYSQL_REPLICA_PASSWORD"},
+		},
+	}
+
+	credentials := m.Credentials()
+	if len(credentials) != 3 {
+		t.Fatalf("expected the credentials of the primary and the replicas, got %d", len(credentials))
+	}
+	tests := []struct {
+		from string
+		want string
+	}{
+		{"env:GORM_ZERO_MYSQL_PASSWORD", "root:primary-secret@tcp(127.0.0.1:3306)"},
+		{"env:GORM_ZERO_MYSQL_PASSWORD", "root:primary-secret@tcp(replica1:3306)"},
+		{"env:GORM_ZERO_MYSQL_REPLICA_PASSWORD", "reader:replica-secret@tcp(replica2:3306)"},
+	}
+	for i, tt := range tests {
+		password, err := config.ResolveSecret(context.Background(), credentials[i].PasswordFrom)
+		if err != nil || credentials[i].PasswordFrom != tt.from {
+			t.Fatalf("expected the password from %s, got %s %v", tt.from, credentials[i].PasswordFrom, err)
+		}
+		if dsn := credentials[i].Dsn(password); !strings.HasPrefix(dsn, tt.want) {
+			t.Fatalf("expected %s, got %s", tt.want, dsn)
+		}
+	}
+	if m.Dsn() != "root@tcp(127.0.0.1:3306)/gormzero" {
+		t.Fatalf("expected the dsn of m to be kept, got %s", m.Dsn())
+	}
+}
+
+func TestMysql_Dsn(t *testing.T) {
+	m := Mysql{
+		Path:     "127.0.0.1",
+		Port:     3306,
+		Config:   "charset%3Dutf8mb4%26parseTime%3Dtrue%26loc%3DLocal",
+		Dbname:   "gormzero",
+		Username: "root",
+		Password: "p@ss/w:rd?&",
+	}
+	cfg, err := mysqlDriver.ParseDSN(m.Dsn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Passwd != m.Password || cfg.Addr != "127.0.0.1:3306" || cfg.DBName != "gormzero" {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+	if !cfg.ParseTime {
+		t.Fatal("expected the url escaped default Config to be applied")
+	}
+
+	redacted := m.RedactedDsn()
+	if strings.Contains(redacted, m.Password) || !strings.Contains(redacted, config.RedactedPassword) {
+		t.Fatalf("expected redacted password, got %s", redacted)
+	}
+}
+
+func TestMysql_DsnConfig(t *testing.T) {
+	// before, the url escaped default Config was passed to the driver as is and ignored,
+	// so parseTime and loc=Local didn't take effect.
+	escaped := Mysql{Path: "127.0.0.1", Port: 3306, Config: "charset%3Dutf8mb4%26parseTime%3Dtrue%26loc%3DLocal"}
+	cfg, err := mysqlDriver.ParseDSN(escaped.Dsn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.ParseTime || cfg.Loc != time.Local || !strings.Contains(escaped.Dsn(), "charset=utf8mb4") {
+		t.Fatalf("expected the unescaped default Config, got %+v", cfg)
+	}
+
+	plain := Mysql{Path: "127.0.0.1", Port: 3306, Config: "charset=utf8&loc=UTC&time_zone=%27%2B00%3A00%27"}
+	cfg, err = mysqlDriver.ParseDSN(plain.Dsn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ParseTime || cfg.Loc != time.UTC || !strings.Contains(plain.Dsn(), "charset=utf8&") ||
+		cfg.Params["time_zone"] != "'+00:00'" {
+		t.Fatalf("expected the Config to be kept, got %+v", cfg)
+	}
+}
+
+func TestMysql_Validate(t *testing.T) {
+	m := Mysql{
+		Port:         0,
+		Config:       "timeout=abc",
+		MaxIdleConns: -1,
+		MaxOpenConns: 10,
+		Replicas:     []config.Replica{{}},
+		TLS:          config.TLS{Mode: "enable"},
+	}
+	err := m.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"Port", "Dbname", "Config", "tls mode", "Replicas[0]", "MaxIdleConns"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error about %s, got %v", want, err)
+		}
+	}
+	if _, err = Connect(m); err == nil {
+		t.Fatal("expected Connect to validate")
+	}
+
+	// Path and Username fall back to the driver defaults.
+	m = Mysql{Port: 3306, Dbname: "gormzero", MaxIdleConns: 10, MaxOpenConns: 10}
+	if err = m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDsnPassword(t *testing.T) {
+	p, ok := config.LookupDsnPassword(DriverName)
+	if !ok {
+		t.Fatal("expected mysql to register a DsnPassword")
+	}
+
+	dsn := "root:old@tcp(127.0.0.1:3306)/gormzero?parseTime=true"
+	if password, err := p.Password(dsn); err != nil || password != "old" {
+		t.Fatalf("expected the password of the dsn, got %q %v", password, err)
+	}
+	withPassword, err := p.WithPassword(dsn, "n@w/p:ss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := mysqlDriver.ParseDSN(withPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Passwd != "n@w/p:ss" || cfg.User != "root" || cfg.DBName != "gormzero" || !cfg.ParseTime {
+		t.Fatalf("expected the new password, got %+v", cfg)
+	}
+}
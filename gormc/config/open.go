@@ -0,0 +1,634 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/logger"
+	"github.com/SpectatorNan/gorm-zero/gormc/plugins"
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+const (
+	defaultPingTimeout   = 5 * time.Second
+	defaultRetryBackoff  = 200 * time.Millisecond
+	defaultRetryMaxDelay = 5 * time.Second
+)
+
+type (
+	// DialectorFunc returns a gorm dialector of dsn.
+	DialectorFunc func(dsn string) gorm.Dialector
+
+	// DBConf is a driver agnostic database config.
+	DBConf struct {
+		Driver          string        // 驱动名, mysql|postgres|sqlite 或自行注册的驱动
+		Dsn             string        // 数据源
+		MaxIdleConns    int           `json:",default=10"`  // 空闲中的最大连接数
+		MaxOpenConns    int           `json:",default=10"`  // 打开到数据库的最大连接数
+		ConnMaxLifetime time.Duration `json:",default=1h"`  // 连接可复用的最大时间
+		ConnMaxIdleTime time.Duration `json:",default=10m"` // 连接最大空闲时间
+		LogMode         string        `json:",default=dev,options=dev|test|prod|silent"`
+		LogColorful     bool          `json:",default=false"` // 是否开启日志高亮
+		SlowThreshold   int64         `json:",default=1000"`
+		Replicas        []ReplicaConf `json:",optional"` // 只读副本
+		// 密码来源, 如 env:DB_PASSWORD, file:/path, 替换 Dsn 及副本 Dsn 中的密码, 驱动需注册 DsnPassword
+		PasswordFrom    string        `json:",optional"`
+		PasswordRefresh time.Duration `json:",default=5m"` // 密码来源的刷新间隔
+	}
+
+	// ReplicaConf is a read replica described by its dsn.
+	ReplicaConf struct {
+		Name   string `json:",optional"`
+		Dsn    string
+		Weight int `json:",default=100"`
+	}
+
+	// Option customizes Open.
+	Option func(o *openOptions)
+
+	openOptions struct {
+		gormConfig      *gorm.Config
+		logger          func(cfg GormLogConfigI) gormLogger.Interface
+		plugins         []gorm.Plugin
+		defaultPlugins  bool
+		maxIdleConns    *int
+		maxOpenConns    *int
+		newDialector    func() (gorm.Dialector, error)
+		lazy            bool
+		pingTimeout     time.Duration
+		retryDeadline   time.Duration
+		retryBackoff    time.Duration
+		retryMaxDelay   time.Duration
+		dsnFunc         DsnFunc
+		replicaDsnFuncs []DsnFunc
+		swapPools       *swapPools
+		slowExplain     bool
+		slowExplainOpts []plugins.SlowExplainOption
+		secrets         []func() []string
+	}
+
+	// ConnDialectorFunc returns a gorm dialector that uses conn, dsn is the dsn conn opens first.
+	ConnDialectorFunc func(conn gorm.ConnPool, dsn string) gorm.Dialector
+
+	// DsnPassword reads and replaces the password of the dsns of a driver,
+	// used for DBConf.PasswordFrom and to redact the passwords of dsns.
+	DsnPassword interface {
+		Password(dsn string) (string, error)
+		WithPassword(dsn, password string) (string, error)
+	}
+
+	// ConnDriver is the database/sql driver of a registered driver.
+	ConnDriver struct {
+		Driver driver.Driver
+		Open   ConnDialectorFunc
+	}
+)
+
+var (
+	drivers      = make(map[string]DialectorFunc)
+	connDrivers  = make(map[string]ConnDriver)
+	dsnPasswords = make(map[string]DsnPassword)
+	driversMu    sync.RWMutex
+)
+
+// RegisterDriver registers a dialector constructor with name, used by Open.
+// mysql, postgres and sqlite register themselves when their config packages are imported,
+// other drivers can be registered the same way, e.g.
+//
+//	config.RegisterDriver("sqlserver", sqlserver.Open)
+//	config.RegisterDriver("clickhouse", clickhouse.Open)
+func RegisterDriver(name string, fn DialectorFunc) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	drivers[name] = fn
+}
+
+// LookupDriver returns the dialector constructor registered with name.
+func LookupDriver(name string) (DialectorFunc, bool) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	fn, ok := drivers[name]
+	return fn, ok
+}
+
+// RegisterConnDriver registers the database/sql driver of name, needed to open it with WithDsnFunc.
+func RegisterConnDriver(name string, d driver.Driver, fn ConnDialectorFunc) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	connDrivers[name] = ConnDriver{Driver: d, Open: fn}
+}
+
+// LookupConnDriver returns the database/sql driver registered with name.
+func LookupConnDriver(name string) (ConnDriver, bool) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	d, ok := connDrivers[name]
+	return d, ok
+}
+
+// RegisterDsnPassword registers how the password of the dsns of name is read and replaced.
+func RegisterDsnPassword(name string, p DsnPassword) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	dsnPasswords[name] = p
+}
+
+// LookupDsnPassword returns the DsnPassword registered with name.
+func LookupDsnPassword(name string) (DsnPassword, bool) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	p, ok := dsnPasswords[name]
+	return p, ok
+}
+
+// WithDsnFunc opens new connections of the primary with the dsn returned by dsn,
+// and those of the i-th replica with replicas[i] if set, e.g. to rotate passwords.
+func WithDsnFunc(dsn DsnFunc, replicas ...DsnFunc) Option {
+	return func(o *openOptions) {
+		o.dsnFunc = dsn
+		o.replicaDsnFuncs = replicas
+	}
+}
+
+// WithGormConfig sets the base gorm config, its Logger is kept if set.
+func WithGormConfig(cfg *gorm.Config) Option {
+	return func(o *openOptions) {
+		o.gormConfig = cfg
+	}
+}
+
+// WithZeroLogger logs sql through go-zero logx, it is the default.
+// Use WithZeroLogger(logger.WithStructured()) to log sql as logx fields,
+// and WithZeroLogger(logger.WithRedactor(r)) to redact the sql of logs and traces.
+func WithZeroLogger(opts ...logger.Option) Option {
+	return func(o *openOptions) {
+		o.logger = func(cfg GormLogConfigI) gormLogger.Interface {
+			return NewZeroLogger(cfg, opts...)
+		}
+	}
+}
+
+// WithStdLogger logs sql to stderr with gorm's standard logger.
+func WithStdLogger() Option {
+	return func(o *openOptions) {
+		o.logger = NewDefaultGormLogger
+	}
+}
+
+// WithLogger sets the gorm logger.
+func WithLogger(l gormLogger.Interface) Option {
+	return func(o *openOptions) {
+		o.logger = func(GormLogConfigI) gormLogger.Interface {
+			return l
+		}
+	}
+}
+
+// WithPlugins installs plugins after the default ones.
+func WithPlugins(p ...gorm.Plugin) Option {
+	return func(o *openOptions) {
+		o.plugins = append(o.plugins, p...)
+	}
+}
+
+// WithoutDefaultPlugins skips installing the tracing plugin.
+func WithoutDefaultPlugins() Option {
+	return func(o *openOptions) {
+		o.defaultPlugins = false
+	}
+}
+
+// WithSlowExplain explains the read statements slower than SlowThreshold, and logs their plans.
+func WithSlowExplain(opts ...plugins.SlowExplainOption) Option {
+	return func(o *openOptions) {
+		o.slowExplain = true
+		o.slowExplainOpts = opts
+	}
+}
+
+// WithPool overrides the pool sizes of DBConf.
+func WithPool(maxIdleConns, maxOpenConns int) Option {
+	return func(o *openOptions) {
+		o.maxIdleConns = &maxIdleConns
+		o.maxOpenConns = &maxOpenConns
+	}
+}
+
+// WithDialector opens the primary with d instead of the registered driver.
+// Every connect attempt reuses d: a failed attempt closes the pool of d, so if d has its own Conn,
+// like sqlite.Dialector{Conn: sqldb}, the retries fail too. Use WithDialectorFunc to retry it.
+func WithDialector(d gorm.Dialector) Option {
+	return WithDialectorFunc(func() (gorm.Dialector, error) {
+		return d, nil
+	})
+}
+
+// WithDialectorFunc opens the primary with a dialector of fn instead of the registered driver,
+// fn is called on every connect attempt, so each gets a new dialector.
+func WithDialectorFunc(fn func() (gorm.Dialector, error)) Option {
+	return func(o *openOptions) {
+		o.newDialector = fn
+	}
+}
+
+// WithRedact redacts the values returned by secrets, e.g. passwords, from the connect logs and errors.
+// secrets is called on each use, so secrets resolved while connecting are redacted too.
+func WithRedact(secrets func() []string) Option {
+	return func(o *openOptions) {
+		o.secrets = append(o.secrets, secrets)
+	}
+}
+
+// WithLazyConnect skips the startup ping, connections are made by the first queries.
+// Dialectors that query the server on initialize, like mysql without SkipInitializeWithVersion,
+// still need it to be reachable.
+func WithLazyConnect() Option {
+	return func(o *openOptions) {
+		o.lazy = true
+	}
+}
+
+// WithFailFast pings the database on startup and returns the first error, it is the default.
+func WithFailFast() Option {
+	return func(o *openOptions) {
+		o.lazy = false
+		o.retryDeadline = 0
+	}
+}
+
+// WithPingTimeout sets the timeout of a startup ping.
+func WithPingTimeout(timeout time.Duration) Option {
+	return func(o *openOptions) {
+		if timeout > 0 {
+			o.pingTimeout = timeout
+		}
+	}
+}
+
+// WithConnectRetry retries to connect with exponential backoff until deadline has passed.
+func WithConnectRetry(deadline time.Duration) Option {
+	return func(o *openOptions) {
+		o.lazy = false
+		o.retryDeadline = deadline
+	}
+}
+
+// WithConnectBackoff sets the first and the max delay between two connect attempts.
+func WithConnectBackoff(backoff, maxDelay time.Duration) Option {
+	return func(o *openOptions) {
+		if backoff > 0 {
+			o.retryBackoff = backoff
+		}
+		if maxDelay > 0 {
+			o.retryMaxDelay = maxDelay
+		}
+	}
+}
+
+// Validate reports every invalid field of c.
+func (c *DBConf) Validate() error {
+	var errs []error
+	if _, ok := LookupDriver(c.Driver); !ok {
+		errs = append(errs, fmt.Errorf("driver %q is not registered", c.Driver))
+	}
+	if len(c.Dsn) == 0 {
+		errs = append(errs, errors.New("dsn is empty"))
+	}
+	if len(c.PasswordFrom) > 0 {
+		if p, ok := LookupDsnPassword(c.Driver); !ok {
+			errs = append(errs, fmt.Errorf("driver %q does not support PasswordFrom", c.Driver))
+		} else if _, err := p.Password(c.Dsn); err != nil && len(c.Dsn) > 0 {
+			errs = append(errs, fmt.Errorf("dsn is invalid: %w", err))
+		}
+	}
+	if c.MaxIdleConns < 0 {
+		errs = append(errs, fmt.Errorf("MaxIdleConns %d is negative", c.MaxIdleConns))
+	}
+	if c.MaxOpenConns < 0 {
+		errs = append(errs, fmt.Errorf("MaxOpenConns %d is negative", c.MaxOpenConns))
+	}
+	if c.ConnMaxLifetime < 0 || c.ConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("ConnMaxLifetime and ConnMaxIdleTime can't be negative"))
+	}
+	switch c.LogMode {
+	case "", "dev", "test", "prod", "silent":
+	default:
+		errs = append(errs, fmt.Errorf("LogMode %q is not one of dev|test|prod|silent", c.LogMode))
+	}
+	for i, r := range c.Replicas {
+		if len(r.Dsn) == 0 {
+			errs = append(errs, fmt.Errorf("Replicas[%d] dsn is empty", i))
+		}
+		if r.Weight < 0 {
+			errs = append(errs, fmt.Errorf("Replicas[%d] Weight %d is negative", i, r.Weight))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *DBConf) GetGormLogMode() gormLogger.LogLevel {
+	return OverwriteGormLogMode(c.LogMode)
+}
+
+func (c *DBConf) GetSlowThreshold() time.Duration {
+	return time.Duration(c.SlowThreshold) * time.Millisecond
+}
+
+func (c *DBConf) GetColorful() bool {
+	return c.LogColorful
+}
+
+func newOpenOptions(opts []Option) openOptions {
+	o := openOptions{
+		logger:         NewDefaultZeroLogger,
+		defaultPlugins: true,
+		pingTimeout:    defaultPingTimeout,
+		retryBackoff:   defaultRetryBackoff,
+		retryMaxDelay:  defaultRetryMaxDelay,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Open opens c with the dialector registered as c.Driver.
+// The passwords of the dsns and of PasswordFrom are redacted from the connect logs and errors.
+func Open(c DBConf, opts ...Option) (*gorm.DB, error) {
+	passwordOpts, err := c.passwordOptions()
+	if err != nil {
+		return nil, err
+	}
+	o := newOpenOptions(append(passwordOpts, opts...))
+	db, err := open(c, &o)
+	return db, o.redactError(err)
+}
+
+func open(c DBConf, o *openOptions) (*gorm.DB, error) {
+	newDialect, ok := LookupDriver(c.Driver)
+	if !ok {
+		return nil, fmt.Errorf("driver %q is not registered", c.Driver)
+	}
+	if o.newDialector == nil && o.dsnFunc == nil && len(c.Dsn) == 0 {
+		return nil, errors.New("dsn is empty")
+	}
+	if _, ok = LookupConnDriver(c.Driver); !ok && (o.dsnFunc != nil || len(o.replicaDsnFuncs) > 0) {
+		return nil, fmt.Errorf("driver %q does not support dsn functions", c.Driver)
+	}
+	// a failed attempt closes the connection pool of its dialector, so every attempt gets a new one,
+	// unless WithDialector reuses the same.
+	newDialector := o.newDialector
+	if newDialector == nil {
+		newDialector = func() (gorm.Dialector, error) {
+			return dialectorOf(c.Driver, c.Dsn, o.dsnFunc, newDialect)
+		}
+	}
+
+	var cfg gorm.Config
+	if o.gormConfig != nil {
+		cfg = *o.gormConfig
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = o.logger(&c)
+	}
+
+	// startup pings are made by connect, replicas keep gorm's automatic ping unless lazy.
+	lazy := o.lazy || cfg.DisableAutomaticPing
+	cfg.DisableAutomaticPing = true
+	db, err := connect(c.Driver, newDialector, &cfg, lazy, o)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DisableAutomaticPing = lazy
+	// the pool is open from here on, close it on any error.
+	if err = o.setup(c, db, newDialect); err != nil {
+		_ = CloseDB(db)
+		return nil, err
+	}
+	return db, nil
+}
+
+// setup installs the plugins and the replicas of c on the connected db, and sizes their pools.
+func (o *openOptions) setup(c DBConf, db *gorm.DB, newDialect DialectorFunc) error {
+	if o.swapPools != nil {
+		if err := o.swapPools.usePrimary(db); err != nil {
+			return err
+		}
+	}
+
+	if o.defaultPlugins {
+		if err := plugins.InitPlugins(db); err != nil {
+			return err
+		}
+	}
+	for _, p := range o.plugins {
+		if err := db.Use(p); err != nil {
+			return err
+		}
+	}
+	if o.slowExplain {
+		if err := db.Use(plugins.NewSlowExplainPlugin(c.GetSlowThreshold(), o.slowExplainOpts...)); err != nil {
+			return err
+		}
+	}
+
+	maxIdleConns, maxOpenConns := o.poolSizes(c)
+
+	if len(c.Replicas) > 0 {
+		replicas := make([]ReplicaDialector, 0, len(c.Replicas))
+		for i, r := range c.Replicas {
+			name := r.Name
+			if len(name) == 0 {
+				name = fmt.Sprintf("replica-%d", i)
+			}
+			var dsnFunc DsnFunc
+			if i < len(o.replicaDsnFuncs) {
+				dsnFunc = o.replicaDsnFuncs[i]
+			}
+			dialector, err := dialectorOf(c.Driver, r.Dsn, dsnFunc, newDialect)
+			if err != nil {
+				return err
+			}
+			if o.swapPools != nil {
+				dialector = o.swapPools.replica(dialector)
+			}
+			replicas = append(replicas, ReplicaDialector{
+				Name:      name,
+				Dialector: dialector,
+				Weight:    r.Weight,
+			})
+		}
+		pool, err := UseReplicas(db, replicas)
+		if err != nil {
+			return err
+		}
+		pool.SetMaxIdleConns(maxIdleConns)
+		pool.SetMaxOpenConns(maxOpenConns)
+		pool.SetConnMaxLifetime(c.ConnMaxLifetime)
+		pool.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+
+	sqldb, err := db.DB()
+	if err != nil {
+		return err
+	}
+	sqldb.SetMaxIdleConns(maxIdleConns)
+	sqldb.SetMaxOpenConns(maxOpenConns)
+	sqldb.SetConnMaxLifetime(c.ConnMaxLifetime)
+	sqldb.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	return nil
+}
+
+// passwordOptions resolves the passwords of c and its replicas from PasswordFrom,
+// and redacts the passwords of their dsns from the connect logs and errors.
+func (c *DBConf) passwordOptions() ([]Option, error) {
+	p, ok := LookupDsnPassword(c.Driver)
+	if !ok {
+		if len(c.PasswordFrom) > 0 {
+			return nil, fmt.Errorf("driver %q does not support PasswordFrom", c.Driver)
+		}
+		return nil, nil
+	}
+	if len(c.PasswordFrom) == 0 {
+		return []Option{WithRedact(c.passwords)}, nil
+	}
+
+	secret := NewSecret(c.PasswordFrom, c.PasswordRefresh)
+	dsnFunc := func(dsn string) DsnFunc {
+		return func(ctx context.Context) (string, error) {
+			password, err := secret.Value(ctx)
+			if err != nil {
+				return "", err
+			}
+			return p.WithPassword(dsn, password)
+		}
+	}
+	replicas := make([]DsnFunc, 0, len(c.Replicas))
+	for _, r := range c.Replicas {
+		replicas = append(replicas, dsnFunc(r.Dsn))
+	}
+	return []Option{
+		WithDsnFunc(dsnFunc(c.Dsn), replicas...),
+		WithRedact(func() []string {
+			return append(c.passwords(), secret.Cached())
+		}),
+	}, nil
+}
+
+// passwords returns the passwords of the dsns of c and its replicas.
+func (c *DBConf) passwords() []string {
+	p, ok := LookupDsnPassword(c.Driver)
+	if !ok {
+		return nil
+	}
+	var passwords []string
+	for _, dsn := range append([]string{c.Dsn}, c.replicaDsns()...) {
+		if password, err := p.Password(dsn); err == nil && len(password) > 0 {
+			passwords = append(passwords, password)
+		}
+	}
+	return passwords
+}
+
+func (c *DBConf) replicaDsns() []string {
+	dsns := make([]string, 0, len(c.Replicas))
+	for _, r := range c.Replicas {
+		dsns = append(dsns, r.Dsn)
+	}
+	return dsns
+}
+
+// redactError redacts the passwords of the dsns of c from err.
+func (c *DBConf) redactError(err error) error {
+	return RedactError(err, c.passwords()...)
+}
+
+// poolSizes returns the pool sizes of c, overridden by WithPool.
+func (o *openOptions) poolSizes(c DBConf) (maxIdleConns, maxOpenConns int) {
+	maxIdleConns, maxOpenConns = c.MaxIdleConns, c.MaxOpenConns
+	if o.maxIdleConns != nil {
+		maxIdleConns = *o.maxIdleConns
+	}
+	if o.maxOpenConns != nil {
+		maxOpenConns = *o.maxOpenConns
+	}
+	return maxIdleConns, maxOpenConns
+}
+
+func dialectorOf(name, dsn string, dsnFunc DsnFunc, newDialect DialectorFunc) (gorm.Dialector, error) {
+	if dsnFunc == nil {
+		return newDialect(dsn), nil
+	}
+
+	cd, _ := LookupConnDriver(name)
+	// the dialector may read settings like the time zone from the dsn.
+	initial, err := dsnFunc(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return cd.Open(sql.OpenDB(NewRotatingConnector(cd.Driver, dsnFunc)), initial), nil
+}
+
+func connect(name string, newDialector func() (gorm.Dialector, error), cfg *gorm.Config, lazy bool, o *openOptions) (*gorm.DB, error) {
+	var deadline time.Time
+	if o.retryDeadline > 0 {
+		deadline = time.Now().Add(o.retryDeadline)
+	}
+	backoff := o.retryBackoff
+
+	for attempt := 1; ; attempt++ {
+		dialector, err := newDialector()
+		var db *gorm.DB
+		if err == nil {
+			db, err = connectOnce(dialector, cfg, lazy, o.pingTimeout)
+		}
+		if err == nil {
+			logx.Infof("connected to %s database, attempt %d", name, attempt)
+			return db, nil
+		}
+
+		err = o.redactError(err)
+		if deadline.IsZero() || time.Now().Add(backoff).After(deadline) {
+			logx.Errorf("connect to %s database failed, attempt %d, giving up: %v", name, attempt, err)
+			return nil, err
+		}
+		logx.Errorf("connect to %s database failed, attempt %d, retrying in %v: %v", name, attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, o.retryMaxDelay)
+	}
+}
+
+// redactError redacts the secrets of WithRedact from err.
+func (o *openOptions) redactError(err error) error {
+	var secrets []string
+	for _, fn := range o.secrets {
+		secrets = append(secrets, fn()...)
+	}
+	return RedactError(err, secrets...)
+}
+
+func connectOnce(dialector gorm.Dialector, cfg *gorm.Config, lazy bool, pingTimeout time.Duration) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, cfg)
+	if err != nil || lazy {
+		return db, err
+	}
+
+	sqldb, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	if err = sqldb.PingContext(ctx); err != nil {
+		_ = sqldb.Close()
+		return nil, err
+	}
+	return db, nil
+}
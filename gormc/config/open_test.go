@@ -0,0 +1,273 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/plugins"
+	"github.com/zeromicro/go-zero/core/logx/logtest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+const testDriver = "sqlite-open-test"
+
+func init() {
+	RegisterDriver(testDriver, sqlite.Open)
+}
+
+func TestOpen(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "open.db")
+
+	t.Run("unknown driver", func(t *testing.T) {
+		if _, err := Open(DBConf{Driver: "oracle", Dsn: dsn}); err == nil {
+			t.Fatal("expected unknown driver error")
+		}
+	})
+
+	t.Run("empty dsn", func(t *testing.T) {
+		if _, err := Open(DBConf{Driver: testDriver}); err == nil {
+			t.Fatal("expected empty dsn error")
+		}
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		db, err := Open(DBConf{Driver: testDriver, Dsn: dsn, MaxOpenConns: 3, LogMode: "prod"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := db.Config.Plugins["gorm-zero-tracing-plugin"]; !ok {
+			t.Fatal("expected tracing plugin to be installed")
+		}
+		if db.Logger == nil || db.Logger == gormLogger.Default {
+			t.Fatal("expected zero logger")
+		}
+		sqldb, _ := db.DB()
+		if sqldb.Stats().MaxOpenConnections != 3 {
+			t.Fatalf("expected max open conns 3, got %d", sqldb.Stats().MaxOpenConnections)
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		custom := gormLogger.Discard
+		db, err := Open(DBConf{Driver: testDriver, Dsn: dsn, MaxOpenConns: 3},
+			WithoutDefaultPlugins(), WithLogger(custom), WithPool(1, 5),
+			WithGormConfig(&gorm.Config{SkipDefaultTransaction: true}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := db.Config.Plugins["gorm-zero-tracing-plugin"]; ok {
+			t.Fatal("expected no tracing plugin")
+		}
+		if db.Logger != custom || !db.SkipDefaultTransaction {
+			t.Fatal("expected custom logger and gorm config")
+		}
+		sqldb, _ := db.DB()
+		if sqldb.Stats().MaxOpenConnections != 5 {
+			t.Fatalf("expected max open conns 5, got %d", sqldb.Stats().MaxOpenConnections)
+		}
+	})
+
+	t.Run("slow explain", func(t *testing.T) {
+		db, err := Open(DBConf{Driver: testDriver, Dsn: dsn}, WithSlowExplain())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := db.Config.Plugins[plugins.SlowExplainPluginName]; !ok {
+			t.Fatal("expected the slow explain plugin to be installed")
+		}
+	})
+
+	t.Run("replicas", func(t *testing.T) {
+		dir := t.TempDir()
+		replicaPath := filepath.Join(dir, "replica.db")
+		openSqlite(t, replicaPath, "replica")
+		primaryPath := filepath.Join(dir, "primary.db")
+		openSqlite(t, primaryPath, "primary")
+
+		db, err := Open(DBConf{
+			Driver:   testDriver,
+			Dsn:      primaryPath,
+			Replicas: []ReplicaConf{{Dsn: replicaPath, Weight: 1}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool := ReplicasOf(db)
+		if pool == nil || pool.Names()[0] != "replica-0" {
+			t.Fatal("expected replica pool")
+		}
+		if name := findName(t, db); name != "replica" {
+			t.Fatalf("expected read from replica, got %s", name)
+		}
+	})
+}
+
+// failingDialector fails to initialize with err.
+type failingDialector struct {
+	sqlite.Dialector
+	err error
+}
+
+func (d failingDialector) Initialize(*gorm.DB) error {
+	return d.err
+}
+
+// lazyDialector opens sqlite without querying it on initialize, like a lazy network driver.
+type lazyDialector struct {
+	sqlite.Dialector
+}
+
+func (d lazyDialector) Initialize(db *gorm.DB) error {
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{LastInsertIDReversed: true})
+	conn, err := sql.Open(sqlite.DriverName, d.DSN)
+	db.ConnPool = conn
+	return err
+}
+
+// failingPlugin fails to initialize with err.
+type failingPlugin struct {
+	err error
+}
+
+func (p failingPlugin) Name() string {
+	return "failing-plugin"
+}
+
+func (p failingPlugin) Initialize(*gorm.DB) error {
+	return p.err
+}
+
+func TestOpen_CloseOnError(t *testing.T) {
+	dir := t.TempDir()
+	for name, opt := range map[string]Option{
+		"plugin": WithPlugins(failingPlugin{err: errors.New("boom")}),
+		"replica": func(o *openOptions) {
+			o.replicaDsnFuncs = []DsnFunc{func(context.Context) (string, error) {
+				return "", errors.New("boom")
+			}}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var sqldb *sql.DB
+			_, err := Open(DBConf{Driver: testDriver, Replicas: []ReplicaConf{{Dsn: filepath.Join(dir, "replica.db")}}},
+				opt, WithDialectorFunc(func() (gorm.Dialector, error) {
+					var err error
+					sqldb, err = sql.Open("sqlite3", filepath.Join(dir, name+".db"))
+					return &sqlite.Dialector{Conn: sqldb}, err
+				}))
+			if err == nil || !strings.Contains(err.Error(), "boom") {
+				t.Fatalf("expected the setup error, got %v", err)
+			}
+			if err = sqldb.Ping(); err == nil || !strings.Contains(err.Error(), "closed") {
+				t.Fatalf("expected the primary pool to be closed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOpen_Startup(t *testing.T) {
+	t.Run("fail fast", func(t *testing.T) {
+		dsn := filepath.Join(t.TempDir(), "missing", "open.db")
+		if _, err := Open(DBConf{Driver: testDriver, Dsn: dsn}, WithFailFast()); err == nil {
+			t.Fatal("expected connect error")
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "late")
+		time.AfterFunc(100*time.Millisecond, func() {
+			_ = os.Mkdir(dir, 0o755)
+		})
+
+		start := time.Now()
+		db, err := Open(DBConf{Driver: testDriver, Dsn: filepath.Join(dir, "open.db")},
+			WithConnectRetry(5*time.Second), WithConnectBackoff(20*time.Millisecond, 50*time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Since(start) < 100*time.Millisecond {
+			t.Fatal("expected to wait for the database")
+		}
+		if err = db.Exec("SELECT 1").Error; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("retry deadline", func(t *testing.T) {
+		dsn := filepath.Join(t.TempDir(), "missing", "open.db")
+		_, err := Open(DBConf{Driver: testDriver, Dsn: dsn},
+			WithConnectRetry(100*time.Millisecond), WithConnectBackoff(20*time.Millisecond, 0))
+		if err == nil {
+			t.Fatal("expected connect error after the deadline")
+		}
+	})
+
+	t.Run("redact", func(t *testing.T) {
+		logs := logtest.NewCollector(t)
+		d := failingDialector{err: errors.New("access denied, password s3cret")}
+		_, err := Open(DBConf{Driver: testDriver}, WithDialector(d),
+			WithConnectRetry(100*time.Millisecond), WithConnectBackoff(20*time.Millisecond, 0),
+			WithRedact(func() []string {
+				return []string{"s3cret"}
+			}))
+		if err == nil || strings.Contains(err.Error(), "s3cret") {
+			t.Fatalf("expected redacted connect error, got %v", err)
+		}
+		if !strings.Contains(logs.String(), "retrying") || strings.Contains(logs.String(), "s3cret") {
+			t.Fatalf("expected redacted retry logs, got %s", logs.String())
+		}
+	})
+
+	t.Run("dialector func", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "missing")
+		var attempts int
+		db, err := Open(DBConf{Driver: testDriver}, WithDialectorFunc(func() (gorm.Dialector, error) {
+			attempts++
+			if attempts > 1 {
+				// the first attempt closed its pool, the retry needs a new one.
+				if err := os.Mkdir(dir, 0o755); err != nil && !os.IsExist(err) {
+					return nil, err
+				}
+			}
+			sqldb, err := sql.Open("sqlite3", filepath.Join(dir, "open.db"))
+			if err != nil {
+				return nil, err
+			}
+			return &sqlite.Dialector{Conn: sqldb}, nil
+		}), WithConnectRetry(time.Second), WithConnectBackoff(10*time.Millisecond, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attempts != 2 {
+			t.Fatalf("expected a dialector per attempt, got %d attempts", attempts)
+		}
+		if err = db.Exec("SELECT 1").Error; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("lazy", func(t *testing.T) {
+		dsn := filepath.Join(t.TempDir(), "missing", "open.db")
+		d := lazyDialector{Dialector: sqlite.Dialector{DSN: dsn}}
+		db, err := Open(DBConf{Driver: testDriver}, WithDialector(d), WithLazyConnect())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = db.Exec("SELECT 1").Error; err == nil {
+			t.Fatal("expected the first query to connect and fail")
+		}
+
+		if _, err = Open(DBConf{Driver: testDriver}, WithDialector(d)); err == nil {
+			t.Fatal("expected startup ping to fail")
+		}
+	})
+}
@@ -1,87 +1,300 @@
 package pg
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/SpectatorNan/gorm-zero/gormc/config"
-	"github.com/SpectatorNan/gorm-zero/gormc/plugins"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"net/url"
+	"strings"
 	"time"
 )
 
+// DriverName is the name postgres is registered with in config.RegisterDriver.
+const DriverName = "postgres"
+
+func init() {
+	config.RegisterDriver(DriverName, func(dsn string) gorm.Dialector {
+		if hasTLSParam(dsn) {
+			return postgres.New(postgres.Config{
+				DSN:  dsn,
+				Conn: sql.OpenDB(tlsConnector{dsn: dsn}),
+			})
+		}
+		return postgres.New(postgres.Config{
+			DSN:                  dsn,
+			PreferSimpleProtocol: true, // disables implicit prepared statement usage
+		})
+	})
+	config.RegisterConnDriver(DriverName, tlsDriver{}, func(conn gorm.ConnPool, dsn string) gorm.Dialector {
+		return postgres.New(postgres.Config{
+			DSN:                  dsn,
+			Conn:                 conn,
+			PreferSimpleProtocol: true,
+		})
+	})
+	config.RegisterDsnPassword(DriverName, dsnPassword{})
+}
+
+// dsnPassword reads and replaces the password of postgres dsns, urls or keyword/value strings.
+type dsnPassword struct{}
+
+func (dsnPassword) Password(dsn string) (string, error) {
+	if isURLDsn(dsn) {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		password, _ := u.User.Password()
+		return password, nil
+	}
+	settings, err := keywordValues(dsn)
+	if err != nil {
+		return "", err
+	}
+	return settings["password"], nil
+}
+
+// WithPassword sets the password of dsn, a later keyword overrides an earlier one.
+func (dsnPassword) WithPassword(dsn, password string) (string, error) {
+	if isURLDsn(dsn) {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		u.User = url.UserPassword(u.User.Username(), password)
+		return u.String(), nil
+	}
+	if _, err := keywordValues(dsn); err != nil {
+		return "", err
+	}
+	return dsn + " password=" + quote(password), nil
+}
+
+func isURLDsn(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// keywordValues parses a keyword/value dsn the way pgconn does.
+func keywordValues(dsn string) (map[string]string, error) {
+	settings := make(map[string]string)
+	s := dsn
+	for len(strings.TrimSpace(s)) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return nil, errors.New("invalid keyword/value")
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t\n\r\v\f")
+
+		quoted := len(s) > 0 && s[0] == '\''
+		if quoted {
+			s = s[1:]
+		}
+		end := 0
+		for ; end < len(s); end++ {
+			if quoted && s[end] == '\'' || !quoted && strings.IndexByte(" \t\n\r\v\f", s[end]) >= 0 {
+				break
+			}
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if quoted && end >= len(s) {
+			return nil, errors.New("unterminated quoted string in connection info string")
+		}
+		if len(key) == 0 {
+			return nil, errors.New("invalid keyword/value")
+		}
+		settings[key] = strings.NewReplacer(`\\`, `\`, `\'`, `'`).Replace(s[:min(end, len(s))])
+		s = s[min(end+1, len(s)):]
+	}
+	return settings, nil
+}
+
 type PgSql struct {
-	Username      string
-	Password      string
-	Path          string
-	Port          int    `json:",default=5432"`
-	SslMode       string `json:",default=disable,options=disable|enable"`
-	TimeZone      string `json:",default=Asia/Shanghai"`
-	Dbname        string
-	MaxIdleConns  int    `json:",default=10"`                               // 空闲中的最大连接数
-	MaxOpenConns  int    `json:",default=10"`                               // 打开到数据库的最大连接数
-	LogMode       string `json:",default=dev,options=dev|test|prod|silent"` // 是否开启Gorm全局日志
-	LogColorful   bool   `json:",default=false"`                             // 是否开启日志高亮
-	SlowThreshold int64  `json:",default=1000"`
+	Username        string
+	Password        string
+	PasswordFrom    string        `json:",optional"`   // 密码来源, 如 env:DB_PASSWORD, file:/path
+	PasswordRefresh time.Duration `json:",default=5m"` // 密码来源的刷新间隔
+	Path            string
+	Port            int    `json:",default=5432"`
+	SslMode         string `json:",default=disable,options=disable|allow|prefer|require|verify-ca|verify-full|enable"` // enable 同 require, 使用 TLS 时不需设置
+	TimeZone        string `json:",default=Asia/Shanghai"`
+	Dbname          string
+	MaxIdleConns    int              `json:",default=10"`                               // 空闲中的最大连接数
+	MaxOpenConns    int              `json:",default=10"`                               // 打开到数据库的最大连接数
+	ConnMaxLifetime time.Duration    `json:",default=1h"`                               // 连接可复用的最大时间
+	ConnMaxIdleTime time.Duration    `json:",default=10m"`                              // 连接最大空闲时间
+	LogMode         string           `json:",default=dev,options=dev|test|prod|silent"` // 是否开启Gorm全局日志
+	LogColorful     bool             `json:",default=false"`                            // 是否开启日志高亮
+	SlowThreshold   int64            `json:",default=1000"`
+	Replicas        []config.Replica `json:",optional"` // 只读副本
+	TLS             config.TLS       `json:",optional"` // TLS 配置, 同 mysql
 }
 
 func (m *PgSql) Dsn() string {
-	return fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%d sslmode=%s TimeZone=%s", m.Username, m.Password, m.Dbname, m.Path, m.Port, m.SslMode, m.TimeZone)
-}
-func (m *PgSql) GetGormLogMode() logger.LogLevel {
-	return config.OverwriteGormLogMode(m.LogMode)
+	dsn := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%d sslmode=%s TimeZone=%s",
+		quote(m.Username), quote(m.Password), quote(m.Dbname), quote(m.Path), m.Port, quote(m.sslMode()), quote(m.TimeZone))
+	if m.TLS.Enabled() {
+		dsn += " " + tlsParam + "=" + m.tlsName()
+	}
+	return dsn
 }
 
-func (m *PgSql) GetSlowThreshold() time.Duration {
-	return time.Duration(m.SlowThreshold) * time.Millisecond
+// RedactedDsn returns the dsn of m with the password redacted, for logging.
+func (m *PgSql) RedactedDsn() string {
+	redacted := *m
+	if len(redacted.Password) > 0 {
+		redacted.Password = config.RedactedPassword
+	}
+	return redacted.Dsn()
 }
-func (m *PgSql) GetColorful() bool {
-	return m.LogColorful
+
+// Validate reports every invalid field of m. An empty Path or Username is left to the driver defaults.
+func (m *PgSql) Validate() error {
+	var errs []error
+	if m.Port <= 0 || m.Port > 65535 {
+		errs = append(errs, fmt.Errorf("pg Port %d is out of range", m.Port))
+	}
+	if len(m.Dbname) == 0 {
+		errs = append(errs, errors.New("pg Dbname is empty"))
+	}
+	switch m.SslMode {
+	case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full", "enable":
+	default:
+		errs = append(errs, fmt.Errorf("pg SslMode %q is not a libpq sslmode", m.SslMode))
+	}
+	if err := m.TLS.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("pg %w", err))
+	}
+	if m.TLS.Enabled() && m.SslMode != "" && m.SslMode != "disable" {
+		errs = append(errs, errors.New("pg SslMode and TLS can't be used together"))
+	}
+	for i, r := range m.Replicas {
+		if err := r.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("pg Replicas[%d]: %w", i, err))
+		}
+	}
+	c := m.DBConf()
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
 
-func Connect(m PgSql) (*gorm.DB, error) {
-	if m.Dbname == "" {
-		return nil, errors.New("database name is empty")
+// quote quotes v as a value of a libpq key/value connection string when needed.
+func quote(v string) string {
+	if len(v) > 0 && !strings.ContainsAny(v, ` '\`) {
+		return v
 	}
-	newLogger := config.NewDefaultGormLogger(&m)
-	pgsqlCfg := postgres.Config{
-		DSN:                  m.Dsn(),
-		PreferSimpleProtocol: true, // disables implicit prepared statement usage
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+// sslMode maps the legacy enable to require, which is not a libpq sslmode.
+// With TLS, the registered tls.Config replaces the one of the sslmode.
+func (m *PgSql) sslMode() string {
+	if m.TLS.Enabled() {
+		return m.TLS.Mode
 	}
-	db, err := gorm.Open(postgres.New(pgsqlCfg), &gorm.Config{
-		Logger: newLogger,
-	})
-	if err != nil {
-		return nil, err
-	} else {
-		sqldb, _ := db.DB()
-		sqldb.SetMaxIdleConns(m.MaxIdleConns)
-		sqldb.SetMaxOpenConns(m.MaxOpenConns)
-		return db, nil
+	if m.SslMode == "enable" {
+		return config.TLSRequire
 	}
+	return m.SslMode
 }
 
-func ConnectWithConfig(m PgSql, cfg *gorm.Config) (*gorm.DB, error) {
-	if m.Dbname == "" {
-		return nil, errors.New("database name is empty")
+func (m *PgSql) replica(r config.Replica) PgSql {
+	replica := *m
+	replica.Path = r.Path
+	if r.Port > 0 {
+		replica.Port = r.Port
 	}
-	pgsqlCfg := postgres.Config{
-		DSN:                  m.Dsn(),
-		PreferSimpleProtocol: true, // disables implicit prepared statement usage
+	if len(r.Username) > 0 {
+		replica.Username = r.Username
+		replica.Password = r.Password
+		replica.PasswordFrom = r.PasswordFrom
 	}
-	db, err := gorm.Open(postgres.New(pgsqlCfg), cfg)
-	if err != nil {
-		return nil, err
+	return replica
+}
+
+// Credentials returns the credentials of m and its replicas, for config.Connect.
+func (m *PgSql) Credentials() []config.Credential {
+	credential := func(c PgSql) config.Credential {
+		return config.Credential{
+			Password:     c.Password,
+			PasswordFrom: c.PasswordFrom,
+			Dsn: func(password string) string {
+				withPassword := c
+				withPassword.Password = password
+				return withPassword.Dsn()
+			},
+		}
 	}
 
-	err = plugins.InitPlugins(db)
-	if err != nil {
-		return nil, err
+	credentials := []config.Credential{credential(*m)}
+	for _, r := range m.Replicas {
+		credentials = append(credentials, credential(m.replica(r)))
+	}
+	return credentials
+}
+
+// DBConf returns the driver agnostic config of m.
+func (m *PgSql) DBConf() config.DBConf {
+	c := config.DBConf{
+		Driver:          DriverName,
+		Dsn:             m.Dsn(),
+		MaxIdleConns:    m.MaxIdleConns,
+		MaxOpenConns:    m.MaxOpenConns,
+		ConnMaxLifetime: m.ConnMaxLifetime,
+		ConnMaxIdleTime: m.ConnMaxIdleTime,
+		LogMode:         m.LogMode,
+		LogColorful:     m.LogColorful,
+		SlowThreshold:   m.SlowThreshold,
+		PasswordRefresh: m.PasswordRefresh,
+	}
+	for _, r := range m.Replicas {
+		replica := m.replica(r)
+		c.Replicas = append(c.Replicas, config.ReplicaConf{
+			Name:   fmt.Sprintf("%s:%d", replica.Path, replica.Port),
+			Dsn:    replica.Dsn(),
+			Weight: r.Weight,
+		})
 	}
-	sqldb, _ := db.DB()
-	sqldb.SetMaxIdleConns(m.MaxIdleConns)
-	sqldb.SetMaxOpenConns(m.MaxOpenConns)
-	return db, nil
+	return c
+}
+
+func (m *PgSql) GetGormLogMode() logger.LogLevel {
+	return config.OverwriteGormLogMode(m.LogMode)
+}
 
+func (m *PgSql) GetSlowThreshold() time.Duration {
+	return time.Duration(m.SlowThreshold) * time.Millisecond
 }
+func (m *PgSql) GetColorful() bool {
+	return m.LogColorful
+}
+
+// Connect opens m, by default with the go-zero logger and the tracing plugin.
+func Connect(m PgSql, opts ...config.Option) (*gorm.DB, error) {
+	return config.Connect(&m, opts...)
+}
+
+// ConnectWithConfig opens m with cfg as the base gorm config.
+func ConnectWithConfig(m PgSql, cfg *gorm.Config, opts ...config.Option) (*gorm.DB, error) {
+	return Connect(m, append([]config.Option{config.WithGormConfig(cfg)}, opts...)...)
+}
+
+// ConnectReloadable opens m like Connect, apply changes of m with Reload.
+func ConnectReloadable(m PgSql, opts ...config.Option) (*config.ReloadableDB, error) {
+	return config.ConnectReloadable(&m, opts...)
+}
+
+// Reload applies m to r, e.g. in the callback of a config.ConfigWatcher.
+func Reload(r *config.ReloadableDB, m PgSql) error {
+	return config.Reload(r, &m)
+}
+
+var _ config.DriverConf = (*PgSql)(nil)
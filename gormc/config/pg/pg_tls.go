@@ -0,0 +1,121 @@
+package pg
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// tlsParam references a tls.Config registered by RegisterTLS in a dsn, like the tls param of mysql.
+// pgx can't set the server name from a dsn, so the param is removed and the tls.Config is set
+// on the parsed config instead.
+const tlsParam = "gorm_zero_tls"
+
+var (
+	tlsParamRegex = regexp.MustCompile(`\s*` + tlsParam + `=(\S+)`)
+	tlsConfigs    sync.Map
+)
+
+type (
+	// tlsDriver opens the dsns with a tlsParam with their registered tls.Config,
+	// the others with the pgx driver.
+	tlsDriver struct{}
+
+	tlsConnector struct {
+		dsn string
+	}
+)
+
+// RegisterTLS registers the tls.Config of m and its replicas, under the names referenced by their Dsn.
+// Connect calls it.
+func (m *PgSql) RegisterTLS() error {
+	if !m.TLS.Enabled() {
+		return nil
+	}
+	if err := m.registerTLS(); err != nil {
+		return err
+	}
+	for _, r := range m.Replicas {
+		replica := m.replica(r)
+		if err := replica.registerTLS(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *PgSql) registerTLS() error {
+	cfg, err := m.TLS.BuildTLSConfig(m.Path)
+	if err != nil {
+		return err
+	}
+	tlsConfigs.Store(m.tlsName(), cfg)
+	return nil
+}
+
+func (m *PgSql) tlsName() string {
+	return fmt.Sprintf("gorm-zero-%s-%d", m.Path, m.Port)
+}
+
+func hasTLSParam(dsn string) bool {
+	return tlsParamRegex.MatchString(dsn)
+}
+
+// connConfig parses dsn with the tls.Config of its tlsParam, without falling back to plaintext.
+func connConfig(dsn string) (*pgx.ConnConfig, error) {
+	var name string
+	if match := tlsParamRegex.FindStringSubmatch(dsn); match != nil {
+		name = match[1]
+		dsn = tlsParamRegex.ReplaceAllString(dsn, "")
+	}
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	// as PreferSimpleProtocol of the dialector.
+	cfg.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	if len(name) == 0 {
+		return cfg, nil
+	}
+
+	tlsConfig, ok := tlsConfigs.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("tls config %s is not registered", name)
+	}
+	cfg.TLSConfig = tlsConfig.(*tls.Config).Clone()
+	cfg.Fallbacks = nil
+	return cfg, nil
+}
+
+func (d tlsDriver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+func (tlsDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	if !hasTLSParam(dsn) {
+		return stdlib.GetDefaultDriver().(driver.DriverContext).OpenConnector(dsn)
+	}
+	return tlsConnector{dsn: dsn}, nil
+}
+
+func (c tlsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	cfg, err := connConfig(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return stdlib.GetConnector(*cfg).Connect(ctx)
+}
+
+func (tlsConnector) Driver() driver.Driver {
+	return tlsDriver{}
+}
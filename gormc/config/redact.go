@@ -0,0 +1,45 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// RedactedPassword replaces passwords in redacted dsns and errors.
+const RedactedPassword = "xxxxx"
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+// RedactError returns err with every occurrence of secrets, plain or url escaped, replaced by RedactedPassword.
+// The returned error unwraps to err, so errors.Is and errors.As keep working.
+func RedactError(err error, secrets ...string) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	redacted := msg
+	for _, secret := range secrets {
+		if len(secret) == 0 {
+			continue
+		}
+		redacted = strings.ReplaceAll(redacted, secret, RedactedPassword)
+		redacted = strings.ReplaceAll(redacted, url.QueryEscape(secret), RedactedPassword)
+		redacted = strings.ReplaceAll(redacted, url.PathEscape(secret), RedactedPassword)
+	}
+	if redacted == msg {
+		return err
+	}
+	return &redactedError{err: err, msg: redacted}
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
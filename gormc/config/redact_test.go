@@ -0,0 +1,27 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRedactError(t *testing.T) {
+	base := errors.New("access denied for root:p@ss/word and " + url.QueryEscape("p@ss/word"))
+	err := RedactError(base, "", "p@ss/word")
+	if strings.Contains(err.Error(), "p@ss") || strings.Count(err.Error(), RedactedPassword) != 2 {
+		t.Fatalf("expected redacted error, got %v", err)
+	}
+	if !errors.Is(err, base) {
+		t.Fatal("expected the redacted error to wrap the original one")
+	}
+
+	if RedactError(nil, "secret") != nil {
+		t.Fatal("expected nil")
+	}
+	other := errors.New("connection refused")
+	if RedactError(other, "secret") != other {
+		t.Fatal("expected errors without secrets to be returned as is")
+	}
+}
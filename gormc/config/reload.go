@@ -0,0 +1,288 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/logger"
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+	drainCheckInterval  = 100 * time.Millisecond
+)
+
+type (
+	// ReloadableDB is a database whose config can be changed without a restart.
+	// Log level, slow threshold and pool settings are applied to the live connection pools,
+	// a changed dsn swaps in a new pool, and the old one is closed once its queries are done.
+	ReloadableDB struct {
+		db    *gorm.DB
+		pools *swapPools
+		opts  []Option
+
+		mu   sync.Mutex
+		conf DBConf
+	}
+
+	// swapPool is a connection pool whose *sql.DB can be replaced while in use.
+	swapPool struct {
+		db atomic.Pointer[sql.DB]
+	}
+
+	swapPools struct {
+		primary  *swapPool
+		replicas []*swapPool
+	}
+
+	// swapDialector opens a replica into its swapPool.
+	swapDialector struct {
+		gorm.Dialector
+		pool *swapPool
+	}
+)
+
+// OpenReloadable opens c like Open, apply changes of c with Reload.
+// gorm's PrepareStmt is not supported.
+func OpenReloadable(c DBConf, opts ...Option) (*ReloadableDB, error) {
+	pools := &swapPools{}
+	c.Replicas = append([]ReplicaConf(nil), c.Replicas...)
+	opts = opts[:len(opts):len(opts)]
+	db, err := Open(c, append(opts, withSwapPools(pools))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReloadableDB{
+		db:    db,
+		pools: pools,
+		opts:  opts,
+		conf:  c,
+	}, nil
+}
+
+func withSwapPools(pools *swapPools) Option {
+	return func(o *openOptions) {
+		o.swapPools = pools
+	}
+}
+
+// DB returns the database, it stays the same across reloads.
+func (r *ReloadableDB) DB() *gorm.DB {
+	return r.db
+}
+
+// Reload applies c to the database, opts are added to the options of OpenReloadable to open swapped pools.
+// The driver, the number of replicas and their weights can't be changed without a restart.
+func (r *ReloadableDB) Reload(c DBConf, opts ...Option) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkRestart(c); err != nil {
+		return err
+	}
+
+	passwordOpts, err := c.passwordOptions()
+	if err != nil {
+		return err
+	}
+	o := newOpenOptions(append(append(passwordOpts, r.opts...), opts...))
+	if c.Dsn != r.conf.Dsn {
+		if err := r.swap(c, "primary", r.pools.primary, c.Dsn, o.dsnFunc, &o); err != nil {
+			return err
+		}
+		r.conf.Dsn = c.Dsn
+	}
+	for i, replica := range c.Replicas {
+		if replica.Dsn == r.conf.Replicas[i].Dsn {
+			continue
+		}
+		var dsnFunc DsnFunc
+		if i < len(o.replicaDsnFuncs) {
+			dsnFunc = o.replicaDsnFuncs[i]
+		}
+		if err := r.swap(c, fmt.Sprintf("replica %d", i), r.pools.replicas[i], replica.Dsn, dsnFunc, &o); err != nil {
+			return err
+		}
+		r.conf.Replicas[i].Dsn = replica.Dsn
+	}
+
+	maxIdleConns, maxOpenConns := o.poolSizes(c)
+	r.pools.primary.SetMaxIdleConns(maxIdleConns)
+	r.pools.primary.SetMaxOpenConns(maxOpenConns)
+	r.pools.primary.SetConnMaxLifetime(c.ConnMaxLifetime)
+	r.pools.primary.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	if pool := ReplicasOf(r.db); pool != nil {
+		pool.SetMaxIdleConns(maxIdleConns)
+		pool.SetMaxOpenConns(maxOpenConns)
+		pool.SetConnMaxLifetime(c.ConnMaxLifetime)
+		pool.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+
+	if l, ok := r.db.Logger.(logger.Reloadable); ok {
+		l.SetLogLevel(c.GetGormLogMode())
+		l.SetSlowThreshold(c.GetSlowThreshold())
+	} else if c.LogMode != r.conf.LogMode || c.SlowThreshold != r.conf.SlowThreshold {
+		logx.Errorf("the logger of %s database can't be reloaded, LogMode and SlowThreshold are ignored", c.Driver)
+	}
+
+	c.Replicas = append([]ReplicaConf(nil), c.Replicas...)
+	r.conf = c
+	logx.Infof("reloaded %s database config", c.Driver)
+	return nil
+}
+
+func (r *ReloadableDB) checkRestart(c DBConf) error {
+	if c.Driver != r.conf.Driver {
+		return fmt.Errorf("driver can't be changed from %q to %q without a restart", r.conf.Driver, c.Driver)
+	}
+	if len(c.Replicas) != len(r.conf.Replicas) {
+		return errors.New("replicas can't be added or removed without a restart")
+	}
+	for i, replica := range c.Replicas {
+		if replica.Weight != r.conf.Replicas[i].Weight {
+			return fmt.Errorf("Replicas[%d] Weight can't be changed without a restart", i)
+		}
+	}
+	return nil
+}
+
+// swap connects to dsn and replaces the connection pool of pool with it.
+func (r *ReloadableDB) swap(c DBConf, name string, pool *swapPool, dsn string, dsnFunc DsnFunc, o *openOptions) error {
+	open, _ := LookupDriver(c.Driver)
+	newDialector := func() (gorm.Dialector, error) {
+		return dialectorOf(c.Driver, dsn, dsnFunc, open)
+	}
+	cfg := gorm.Config{Logger: gormLogger.Discard, DisableAutomaticPing: true}
+	db, err := connect(c.Driver, newDialector, &cfg, false, o)
+	if err != nil {
+		return fmt.Errorf("swap %s connection pool: %w", name, err)
+	}
+	sqldb, err := db.DB()
+	if err != nil {
+		return err
+	}
+
+	maxIdleConns, maxOpenConns := o.poolSizes(c)
+	sqldb.SetMaxIdleConns(maxIdleConns)
+	sqldb.SetMaxOpenConns(maxOpenConns)
+	sqldb.SetConnMaxLifetime(c.ConnMaxLifetime)
+	sqldb.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+
+	old := pool.db.Swap(sqldb)
+	logx.Infof("swapped %s connection pool of %s database", name, c.Driver)
+	go drainPool(fmt.Sprintf("%s of %s", name, c.Driver), old, defaultDrainTimeout)
+	return nil
+}
+
+// drainPool closes db once it has no connections in use or timeout has passed.
+// Queries may still pick db right after the swap, so it waits for at least one check interval.
+func drainPool(name string, db *sql.DB, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for {
+		time.Sleep(drainCheckInterval)
+		if db.Stats().InUse == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			logx.Errorf("closing swapped %s connection pool with %d connections in use", name, db.Stats().InUse)
+			break
+		}
+	}
+	if err := db.Close(); err != nil {
+		logx.Errorf("close swapped %s connection pool: %v", name, err)
+	}
+}
+
+func (p *swapPools) usePrimary(db *gorm.DB) error {
+	sqldb, ok := db.ConnPool.(*sql.DB)
+	if !ok {
+		return fmt.Errorf("reloadable database needs a *sql.DB connection pool, got %T", db.ConnPool)
+	}
+	p.primary = &swapPool{}
+	p.primary.db.Store(sqldb)
+	db.ConnPool = p.primary
+	db.Statement.ConnPool = p.primary
+	return nil
+}
+
+func (p *swapPools) replica(d gorm.Dialector) gorm.Dialector {
+	pool := &swapPool{}
+	p.replicas = append(p.replicas, pool)
+	return swapDialector{Dialector: d, pool: pool}
+}
+
+func (d swapDialector) Initialize(db *gorm.DB) error {
+	if err := d.Dialector.Initialize(db); err != nil {
+		return err
+	}
+	sqldb, ok := db.ConnPool.(*sql.DB)
+	if !ok {
+		return fmt.Errorf("reloadable replica needs a *sql.DB connection pool, got %T", db.ConnPool)
+	}
+	d.pool.db.Store(sqldb)
+	db.ConnPool = d.pool
+	return nil
+}
+
+func (p *swapPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.db.Load().PrepareContext(ctx, query)
+}
+
+func (p *swapPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.db.Load().ExecContext(ctx, query, args...)
+}
+
+func (p *swapPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.db.Load().QueryContext(ctx, query, args...)
+}
+
+func (p *swapPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.db.Load().QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx implements gorm.TxBeginner, the transaction stays on its pool when swapped.
+func (p *swapPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return p.db.Load().BeginTx(ctx, opts)
+}
+
+// GetDBConn implements gorm.GetDBConnector, it returns the current pool.
+func (p *swapPool) GetDBConn() (*sql.DB, error) {
+	return p.db.Load(), nil
+}
+
+func (p *swapPool) Ping() error {
+	return p.db.Load().Ping()
+}
+
+func (p *swapPool) Stats() sql.DBStats {
+	return p.db.Load().Stats()
+}
+
+func (p *swapPool) SetMaxIdleConns(n int) {
+	p.db.Load().SetMaxIdleConns(n)
+}
+
+func (p *swapPool) SetMaxOpenConns(n int) {
+	p.db.Load().SetMaxOpenConns(n)
+}
+
+func (p *swapPool) SetConnMaxLifetime(d time.Duration) {
+	p.db.Load().SetConnMaxLifetime(d)
+}
+
+func (p *swapPool) SetConnMaxIdleTime(d time.Duration) {
+	p.db.Load().SetConnMaxIdleTime(d)
+}
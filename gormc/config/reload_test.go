@@ -0,0 +1,156 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/logger"
+)
+
+func waitClosed(t *testing.T, db *sql.DB) {
+	deadline := time.Now().Add(3 * time.Second)
+	for db.Ping() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the swapped pool to be closed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReloadableDB(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"primary", "primary2", "replica", "replica2"} {
+		openSqlite(t, filepath.Join(dir, name+".db"), name)
+	}
+	c := DBConf{
+		Driver:        testDriver,
+		Dsn:           filepath.Join(dir, "primary.db"),
+		MaxIdleConns:  2,
+		MaxOpenConns:  2,
+		LogMode:       "dev",
+		SlowThreshold: 1000,
+		Replicas:      []ReplicaConf{{Dsn: filepath.Join(dir, "replica.db"), Weight: 1}},
+	}
+	r, err := OpenReloadable(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := r.DB()
+	primary, _ := db.DB()
+	ctx := context.Background()
+
+	t.Run("pool and logger", func(t *testing.T) {
+		c.MaxOpenConns = 5
+		c.LogMode = "prod"
+		if err := r.Reload(c); err != nil {
+			t.Fatal(err)
+		}
+		sqldb, _ := db.DB()
+		if sqldb != primary || sqldb.Stats().MaxOpenConnections != 5 {
+			t.Fatal("expected the pool size to change without reconnecting")
+		}
+		replica, _ := ReplicasOf(db).Conn(0)
+		if replica.(interface{ Stats() sql.DBStats }).Stats().MaxOpenConnections != 5 {
+			t.Fatal("expected the pool size of the replica to change")
+		}
+		if _, ok := db.Logger.(logger.Reloadable); !ok {
+			t.Fatal("expected a reloadable logger")
+		}
+	})
+
+	t.Run("dsn", func(t *testing.T) {
+		tx := db.Begin()
+		c.Dsn = filepath.Join(dir, "primary2.db")
+		c.Replicas[0].Dsn = filepath.Join(dir, "replica2.db")
+		if err := r.Reload(c); err != nil {
+			t.Fatal(err)
+		}
+		if name := findName(t, db.WithContext(UsePrimary(ctx))); name != "primary2" {
+			t.Fatalf("expected the swapped primary, got %s", name)
+		}
+		if name := findName(t, db); name != "replica2" {
+			t.Fatalf("expected the swapped replica, got %s", name)
+		}
+		if sqldb, _ := db.DB(); sqldb.Stats().MaxOpenConnections != 5 {
+			t.Fatal("expected the swapped pool to keep the pool size")
+		}
+
+		// the transaction started before the swap finishes on the old pool.
+		if name := findName(t, tx); name != "primary" {
+			t.Fatalf("expected the transaction on the old primary, got %s", name)
+		}
+		time.Sleep(3 * drainCheckInterval)
+		if primary.Ping() != nil {
+			t.Fatal("expected the old pool to be kept while in use")
+		}
+		if err := tx.Commit().Error; err != nil {
+			t.Fatal(err)
+		}
+		waitClosed(t, primary)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		invalid := c
+		invalid.Replicas = nil
+		if err := r.Reload(invalid); err == nil {
+			t.Fatal("expected removing replicas to need a restart")
+		}
+		invalid = c
+		invalid.Driver = "sqlite-open-test-other"
+		RegisterDriver(invalid.Driver, nil)
+		if err := r.Reload(invalid); err == nil {
+			t.Fatal("expected changing the driver to need a restart")
+		}
+		invalid = c
+		invalid.Dsn = filepath.Join(dir, "missing", "open.db")
+		if err := r.Reload(invalid); err == nil {
+			t.Fatal("expected an unreachable dsn to fail")
+		}
+		if name := findName(t, db.WithContext(UsePrimary(ctx))); name != "primary2" {
+			t.Fatalf("expected to keep the pool on failure, got %s", name)
+		}
+	})
+}
+
+func TestConfigWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "etc.yaml")
+	write := func(mode string) {
+		content := fmt.Sprintf("DB:\n  Driver: %s\n  Dsn: test.db\n  LogMode: %s\n", testDriver, mode)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	type config struct {
+		DB DBConf
+	}
+
+	write("dev")
+	var changes []string
+	w := NewConfigWatcher(path, func(c config) error {
+		changes = append(changes, c.DB.LogMode)
+		return nil
+	})
+	check := func() {
+		if err := w.CheckOnce(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check()
+	write("prod")
+	check()
+	check()
+	write("invalid")
+	if err := w.CheckOnce(); err == nil {
+		t.Fatal("expected a load error")
+	}
+	check()
+	if len(changes) != 1 || changes[0] != "prod" {
+		t.Fatalf("expected one change to prod, got %v", changes)
+	}
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	replicaPluginName        = "gorm-zero-replica-plugin"
+	callBackForcePrimaryName = "gorm-zero-replica:force_primary"
+)
+
+type (
+	// Replica is a read replica of the primary database,
+	// empty fields are inherited from the primary config.
+	Replica struct {
+		Path         string // 服务器地址
+		Port         int    `json:",optional"`    // 端口
+		Username     string `json:",optional"`    // 数据库用户名
+		Password     string `json:",optional"`    // 数据库密码
+		PasswordFrom string `json:",optional"`    // 密码来源, 与 Username 一起生效
+		Weight       int    `json:",default=100"` // 读流量权重
+	}
+
+	// ReplicaDialector is a replica ready to be opened by gorm.
+	ReplicaDialector struct {
+		Name      string
+		Dialector gorm.Dialector
+		Weight    int
+	}
+
+	// ReplicaPool chooses a healthy replica by weight for plain reads.
+	// It implements dbresolver.Policy, the last conn pool is the primary,
+	// which is used only when no replica can serve.
+	ReplicaPool struct {
+		names    []string
+		weights  []int
+		evicted  []atomic.Bool
+		resolver *dbresolver.DBResolver
+		conns    []gorm.ConnPool
+	}
+
+	replicaPlugin struct {
+		replicas []ReplicaDialector
+		pool     *ReplicaPool
+	}
+
+	// replicaDialector opens a replica and records its connection pool.
+	replicaDialector struct {
+		gorm.Dialector
+		conn *gorm.ConnPool
+	}
+
+	// primaryDialector opens nothing, it reuses the connection pool of the primary.
+	primaryDialector struct {
+		gorm.Dialector
+		conn gorm.ConnPool
+	}
+
+	primaryCtxKey      struct{}
+	primaryTableCtxKey struct{}
+)
+
+// UsePrimary returns a ctx that sends every query run with it to the primary.
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+// IsPrimaryForced reports whether ctx was returned by UsePrimary.
+func IsPrimaryForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(primaryCtxKey{}).(bool)
+	return forced
+}
+
+// UsePrimaryFor returns a ctx that sends the queries on tables matched by fn to the primary.
+func UsePrimaryFor(ctx context.Context, fn func(table string) bool) context.Context {
+	return context.WithValue(ctx, primaryTableCtxKey{}, fn)
+}
+
+// UseReplicas routes plain reads of db to replicas, writes and transactions stay on the primary.
+func UseReplicas(db *gorm.DB, replicas []ReplicaDialector) (*ReplicaPool, error) {
+	if len(replicas) == 0 {
+		return nil, errors.New("no replicas")
+	}
+	plugin := &replicaPlugin{
+		replicas: replicas,
+	}
+	if err := db.Use(plugin); err != nil {
+		return nil, err
+	}
+	return plugin.pool, nil
+}
+
+// ReplicasOf returns the ReplicaPool of db, or nil if db has no replicas.
+func ReplicasOf(db *gorm.DB) *ReplicaPool {
+	if plugin, ok := db.Config.Plugins[replicaPluginName].(*replicaPlugin); ok {
+		return plugin.pool
+	}
+	return nil
+}
+
+func (p *replicaPlugin) Name() string {
+	return replicaPluginName
+}
+
+func (p *replicaPlugin) Initialize(db *gorm.DB) error {
+	pool := &ReplicaPool{
+		evicted: make([]atomic.Bool, len(p.replicas)),
+		conns:   make([]gorm.ConnPool, len(p.replicas)),
+	}
+	dialectors := make([]gorm.Dialector, 0, len(p.replicas)+1)
+	for i, replica := range p.replicas {
+		pool.names = append(pool.names, replica.Name)
+		pool.weights = append(pool.weights, replica.Weight)
+		dialectors = append(dialectors, replicaDialector{Dialector: replica.Dialector, conn: &pool.conns[i]})
+	}
+	dialectors = append(dialectors, primaryDialector{Dialector: db.Dialector, conn: db.ConnPool})
+
+	pool.resolver = dbresolver.Register(dbresolver.Config{
+		Replicas: dialectors,
+		Policy:   pool,
+	})
+	if err := db.Use(pool.resolver); err != nil {
+		return err
+	}
+	p.pool = pool
+
+	if err := db.Callback().Query().Before("gorm:query").Register(callBackForcePrimaryName, forcePrimary); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register(callBackForcePrimaryName, forcePrimary); err != nil {
+		return err
+	}
+	return db.Callback().Raw().Before("gorm:raw").Register(callBackForcePrimaryName, forcePrimary)
+}
+
+func (d replicaDialector) Initialize(db *gorm.DB) error {
+	if err := d.Dialector.Initialize(db); err != nil {
+		return err
+	}
+	*d.conn = db.ConnPool
+	return nil
+}
+
+func (d primaryDialector) Initialize(db *gorm.DB) error {
+	db.ConnPool = d.conn
+	return nil
+}
+
+// Validate reports the invalid fields of r.
+func (r Replica) Validate() error {
+	var errs []error
+	if len(r.Path) == 0 {
+		errs = append(errs, errors.New("replica Path is empty"))
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		errs = append(errs, fmt.Errorf("replica %s Port %d is out of range", r.Path, r.Port))
+	}
+	return errors.Join(errs...)
+}
+
+// Names returns the replica names in registration order.
+func (p *ReplicaPool) Names() []string {
+	return p.names
+}
+
+// Len returns the number of replicas.
+func (p *ReplicaPool) Len() int {
+	return len(p.names)
+}
+
+// Evict removes the i-th replica from the read pool.
+func (p *ReplicaPool) Evict(i int) {
+	p.evicted[i].Store(true)
+}
+
+// Restore adds the i-th replica back to the read pool.
+func (p *ReplicaPool) Restore(i int) {
+	p.evicted[i].Store(false)
+}
+
+// Healthy reports whether the i-th replica is in the read pool.
+func (p *ReplicaPool) Healthy(i int) bool {
+	return !p.evicted[i].Load()
+}
+
+// Conn returns the connection pool of the i-th replica.
+func (p *ReplicaPool) Conn(i int) (gorm.ConnPool, error) {
+	if i < 0 || i >= len(p.conns) {
+		return nil, errors.New("replica index out of range")
+	}
+	if p.conns[i] == nil {
+		return nil, fmt.Errorf("replica %s is not opened", p.names[i])
+	}
+	return p.conns[i], nil
+}
+
+// SetMaxIdleConns sets the max idle connections of every replica.
+func (p *ReplicaPool) SetMaxIdleConns(n int) {
+	p.resolver.SetMaxIdleConns(n)
+}
+
+// SetMaxOpenConns sets the max open connections of every replica.
+func (p *ReplicaPool) SetMaxOpenConns(n int) {
+	p.resolver.SetMaxOpenConns(n)
+}
+
+// SetConnMaxLifetime sets the max lifetime of the connections of every replica.
+func (p *ReplicaPool) SetConnMaxLifetime(d time.Duration) {
+	p.resolver.SetConnMaxLifetime(d)
+}
+
+// SetConnMaxIdleTime sets the max idle time of the connections of every replica.
+func (p *ReplicaPool) SetConnMaxIdleTime(d time.Duration) {
+	p.resolver.SetConnMaxIdleTime(d)
+}
+
+// Resolve implements dbresolver.Policy.
+func (p *ReplicaPool) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	primary := connPools[len(connPools)-1]
+	var total int
+	for i, w := range p.weights {
+		if p.Healthy(i) {
+			total += max(w, 0)
+		}
+	}
+	if total <= 0 {
+		return primary
+	}
+
+	n := rand.IntN(total)
+	for i, w := range p.weights {
+		if w <= 0 || !p.Healthy(i) {
+			continue
+		}
+		if n < w {
+			return connPools[i]
+		}
+		n -= w
+	}
+	return primary
+}
+
+func forcePrimary(db *gorm.DB) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		return
+	}
+	if IsPrimaryForced(ctx) {
+		dbresolver.Write.ModifyStatement(db.Statement)
+		return
+	}
+	if fn, ok := ctx.Value(primaryTableCtxKey{}).(func(string) bool); ok && fn(db.Statement.Table) {
+		dbresolver.Write.ModifyStatement(db.Statement)
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type replicaTestUser struct {
+	Id   uint64 `gorm:"column:id;primaryKey"`
+	Name string `gorm:"column:name"`
+}
+
+func openSqlite(t *testing.T, path string, name string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	if err = db.AutoMigrate(&replicaTestUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Create(&replicaTestUser{Id: 1, Name: name}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createReplicatedDB(t *testing.T, weight int) (*gorm.DB, *ReplicaPool) {
+	dir := t.TempDir()
+	replicaPath := filepath.Join(dir, "replica.db")
+	openSqlite(t, replicaPath, "replica")
+	db := openSqlite(t, filepath.Join(dir, "primary.db"), "primary")
+
+	pool, err := UseReplicas(db, []ReplicaDialector{
+		{Name: "replica", Dialector: sqlite.Open(replicaPath), Weight: weight},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, pool
+}
+
+func findName(t *testing.T, db *gorm.DB) string {
+	var user replicaTestUser
+	if err := db.Take(&user, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user.Name
+}
+
+func TestUseReplicas(t *testing.T) {
+	db, pool := createReplicatedDB(t, 100)
+	ctx := context.Background()
+
+	if ReplicasOf(db) != pool || len(pool.Names()) != 1 {
+		t.Fatal("expected the replica pool to be registered on db")
+	}
+	if name := findName(t, db.WithContext(ctx)); name != "replica" {
+		t.Fatalf("expected plain read from replica, got %s", name)
+	}
+	if name := findName(t, db.WithContext(UsePrimary(ctx))); name != "primary" {
+		t.Fatalf("expected forced read from primary, got %s", name)
+	}
+
+	var raw string
+	if err := db.WithContext(UsePrimary(ctx)).Raw("SELECT name FROM replica_test_users WHERE id = 1").
+		Scan(&raw).Error; err != nil || raw != "primary" {
+		t.Fatalf("expected forced raw read from primary, got %s %v", raw, err)
+	}
+
+	byTable := UsePrimaryFor(ctx, func(table string) bool {
+		return table == "replica_test_users"
+	})
+	if name := findName(t, db.WithContext(byTable)); name != "primary" {
+		t.Fatalf("expected read on matched table from primary, got %s", name)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if name := findName(t, tx); name != "primary" {
+			t.Errorf("expected read in transaction from primary, got %s", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.Create(&replicaTestUser{Id: 2, Name: "written"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var cnt int64
+	db.WithContext(UsePrimary(ctx)).Model(&replicaTestUser{}).Where("id = 2").Count(&cnt)
+	if cnt != 1 {
+		t.Fatal("expected write on primary")
+	}
+}
+
+func TestReplicaPool_ZeroWeightFallsBackToPrimary(t *testing.T) {
+	db, _ := createReplicatedDB(t, 0)
+	if name := findName(t, db); name != "primary" {
+		t.Fatalf("expected read from primary, got %s", name)
+	}
+}
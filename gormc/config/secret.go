@@ -0,0 +1,230 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	// SecretEnv resolves env:NAME to the environment variable NAME.
+	SecretEnv = "env"
+	// SecretFile resolves file:/path to the content of the file, e.g. a kubernetes secret mount.
+	SecretFile = "file"
+	// SecretCmd resolves cmd:program args to the stdout of the program, e.g. a cli of a secret manager.
+	// The program is run without a shell and killed after DefaultSecretCmdTimeout.
+	SecretCmd = "cmd"
+
+	// DefaultSecretCmdTimeout is the timeout of the programs of SecretCmd.
+	DefaultSecretCmdTimeout = 10 * time.Second
+
+	// maxSecretCmdStderr bounds the stderr of a program kept in its error.
+	maxSecretCmdStderr = 512
+)
+
+type (
+	// SecretProvider resolves the reference of a secret, the part after the scheme.
+	SecretProvider interface {
+		Secret(ctx context.Context, ref string) (string, error)
+	}
+
+	// SecretProviderFunc is an adapter to allow the use of ordinary functions as SecretProvider.
+	SecretProviderFunc func(ctx context.Context, ref string) (string, error)
+
+	// Secret is a secret resolved from a source like env:DB_PASSWORD,
+	// cached and resolved again once ttl has passed.
+	Secret struct {
+		source    string
+		ttl       time.Duration
+		mu        sync.Mutex
+		value     string
+		expireAt  time.Time
+		resolving *secretFlight
+	}
+
+	// secretFlight is a running resolve of a Secret, done is closed once it has finished with err.
+	secretFlight struct {
+		done chan struct{}
+		err  error
+	}
+)
+
+var (
+	secretProviders = map[string]SecretProvider{
+		SecretEnv:  SecretProviderFunc(envSecret),
+		SecretFile: SecretProviderFunc(fileSecret),
+		SecretCmd:  NewCmdSecretProvider(DefaultSecretCmdTimeout),
+	}
+	secretProvidersMu sync.RWMutex
+)
+
+// Secret calls f(ctx, ref).
+func (f SecretProviderFunc) Secret(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+// NewCmdSecretProvider returns a SecretProvider that runs the program of cmd:program args without a shell
+// and resolves the secret to its stdout, trimmed of trailing newlines. The program is killed after timeout.
+// The error of a failed program keeps the head of its stderr, with any stdout redacted.
+func NewCmdSecretProvider(timeout time.Duration) SecretProvider {
+	return SecretProviderFunc(func(ctx context.Context, command string) (string, error) {
+		return cmdSecret(ctx, command, timeout)
+	})
+}
+
+// RegisterSecretProvider registers p for sources of scheme, e.g. a vault client for vault:path#key.
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[scheme] = p
+}
+
+// ResolveSecret resolves source, which is formatted as scheme:ref.
+func ResolveSecret(ctx context.Context, source string) (string, error) {
+	scheme, ref, ok := strings.Cut(source, ":")
+	if !ok {
+		return "", fmt.Errorf("secret source %q has no scheme", source)
+	}
+
+	secretProvidersMu.RLock()
+	p, ok := secretProviders[scheme]
+	secretProvidersMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("secret provider %q is not registered", scheme)
+	}
+	return p.Secret(ctx, ref)
+}
+
+// NewSecret returns a Secret of source, a ttl of 0 resolves it only once.
+func NewSecret(source string, ttl time.Duration) *Secret {
+	return &Secret{
+		source: source,
+		ttl:    ttl,
+	}
+}
+
+// Value returns the cached secret, or resolves it when expired.
+// One caller resolves it at a time, the others get the stale value meanwhile, or wait for the first one.
+// If resolving fails after the secret has been resolved once, the stale value is returned.
+func (s *Secret) Value(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	for {
+		resolved := !s.expireAt.IsZero()
+		if resolved && (s.ttl <= 0 || time.Now().Before(s.expireAt) || s.resolving != nil) {
+			value := s.value
+			s.mu.Unlock()
+			return value, nil
+		}
+		if s.resolving == nil {
+			break
+		}
+
+		// wait for the first resolve, and share its error.
+		flight := s.resolving
+		s.mu.Unlock()
+		select {
+		case <-flight.done:
+			if flight.err != nil {
+				return "", flight.err
+			}
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	flight := &secretFlight{done: make(chan struct{})}
+	s.resolving = flight
+	s.mu.Unlock()
+
+	value, err := ResolveSecret(ctx, s.source)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resolving = nil
+	flight.err = err
+	close(flight.done)
+	if err != nil {
+		if s.expireAt.IsZero() {
+			return "", err
+		}
+		logx.WithContext(ctx).Errorf("refresh secret %s failed, keep the stale value: %v", s.source, err)
+		return s.value, nil
+	}
+	s.value = value
+	s.expireAt = time.Now().Add(s.ttl)
+	return value, nil
+}
+
+// Cached returns the last resolved secret without resolving it.
+func (s *Secret) Cached() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value
+}
+
+func envSecret(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+func fileSecret(_ context.Context, path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimRight(string(content), "\r\n")
+	if len(value) == 0 {
+		return "", errors.New("secret file " + path + " is empty")
+	}
+	return value, nil
+}
+
+func cmdSecret(ctx context.Context, command string, timeout time.Duration) (string, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return "", errors.New("secret command is empty")
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// don't wait for children that keep the pipes open after the program is killed.
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w: %w", err, ctx.Err())
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxSecretCmdStderr {
+			msg = msg[:maxSecretCmdStderr] + "..."
+		}
+		if len(msg) > 0 {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", RedactError(fmt.Errorf("secret command %s: %w", args[0], err),
+			strings.TrimRight(stdout.String(), "\r\n"))
+	}
+
+	value := strings.TrimRight(stdout.String(), "\r\n")
+	if len(value) == 0 {
+		return "", errors.New("secret command " + args[0] + " printed nothing")
+	}
+	return value, nil
+}
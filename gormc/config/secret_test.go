@@ -0,0 +1,201 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	RegisterConnDriver(testDriver, &sqlite3.SQLiteDriver{}, func(conn gorm.ConnPool, dsn string) gorm.Dialector {
+		return &sqlite.Dialector{DSN: dsn, Conn: conn}
+	})
+}
+
+func TestResolveSecret(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("GORM_ZERO_TEST_PASSWORD", "p@ss")
+	if v, err := ResolveSecret(ctx, "env:GORM_ZERO_TEST_PASSWORD"); err != nil || v != "p@ss" {
+		t.Fatalf("expected env secret, got %q %v", v, err)
+	}
+	if _, err := ResolveSecret(ctx, "env:GORM_ZERO_TEST_MISSING"); err == nil {
+		t.Fatal("expected missing env error")
+	}
+
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ResolveSecret(ctx, "file:"+path); err != nil || v != "from-file" {
+		t.Fatalf("expected file secret, got %q %v", v, err)
+	}
+
+	RegisterSecretProvider("vault-test", SecretProviderFunc(func(_ context.Context, ref string) (string, error) {
+		return "vault:" + ref, nil
+	}))
+	if v, err := ResolveSecret(ctx, "vault-test:db#password"); err != nil || v != "vault:db#password" {
+		t.Fatalf("expected custom secret, got %q %v", v, err)
+	}
+
+	if _, err := ResolveSecret(ctx, "unknown:x"); err == nil {
+		t.Fatal("expected unknown provider error")
+	}
+	if _, err := ResolveSecret(ctx, "plaintext"); err == nil {
+		t.Fatal("expected missing scheme error")
+	}
+}
+
+func TestResolveSecret_Cmd(t *testing.T) {
+	ctx := context.Background()
+	if v, err := ResolveSecret(ctx, "cmd:echo from-cmd"); err != nil || v != "from-cmd" {
+		t.Fatalf("expected cmd secret, got %q %v", v, err)
+	}
+	if _, err := ResolveSecret(ctx, "cmd:true"); err == nil {
+		t.Fatal("expected empty output error")
+	}
+	if _, err := ResolveSecret(ctx, "cmd: "); err == nil {
+		t.Fatal("expected empty command error")
+	}
+
+	script := filepath.Join(t.TempDir(), "secret.sh")
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho s3cret\necho \"denied, got s3cret\" >&2\nexit 1\n"), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ResolveSecret(ctx, "cmd:"+script)
+	if err == nil || !strings.Contains(err.Error(), "denied") || strings.Contains(err.Error(), "s3cret") {
+		t.Fatalf("expected the redacted stderr, got %v", err)
+	}
+
+	start := time.Now()
+	_, err = NewCmdSecretProvider(50*time.Millisecond).Secret(ctx, "sleep 5")
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 2*time.Second {
+		t.Fatalf("expected the command to time out, got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestSecret_Refresh(t *testing.T) {
+	var calls atomic.Int32
+	var fail atomic.Bool
+	RegisterSecretProvider("counter-test", SecretProviderFunc(func(context.Context, string) (string, error) {
+		if fail.Load() {
+			return "", errors.New("backend down")
+		}
+		return string(rune('a' + calls.Add(1) - 1)), nil
+	}))
+
+	ctx := context.Background()
+	s := NewSecret("counter-test:x", 50*time.Millisecond)
+	if v, _ := s.Value(ctx); v != "a" {
+		t.Fatalf("expected a, got %s", v)
+	}
+	if v, _ := s.Value(ctx); v != "a" {
+		t.Fatalf("expected cached a, got %s", v)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if v, _ := s.Value(ctx); v != "b" {
+		t.Fatalf("expected refreshed b, got %s", v)
+	}
+
+	fail.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	if v, err := s.Value(ctx); err != nil || v != "b" {
+		t.Fatalf("expected stale b, got %s %v", v, err)
+	}
+
+	if _, err := NewSecret("counter-test:x", time.Minute).Value(ctx); err == nil {
+		t.Fatal("expected error without a stale value")
+	}
+}
+
+func TestSecret_SingleFlight(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	RegisterSecretProvider("blocking-test", SecretProviderFunc(func(context.Context, string) (string, error) {
+		n := calls.Add(1)
+		<-release
+		return string(rune('a' + n - 1)), nil
+	}))
+
+	ctx := context.Background()
+	s := NewSecret("blocking-test:x", 50*time.Millisecond)
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := s.Value(ctx); err != nil || v != "a" {
+				t.Errorf("expected the first value, got %s %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	release <- struct{}{}
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("expected one resolve of the first value, got %d", calls.Load())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	refreshed := make(chan string)
+	go func() {
+		v, _ := s.Value(ctx)
+		refreshed <- v
+	}()
+	for calls.Load() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	// the refresh is blocked in the provider, others get the stale value without waiting.
+	if v, err := s.Value(ctx); err != nil || v != "a" || s.Cached() != "a" {
+		t.Fatalf("expected the stale value during the refresh, got %s %v", v, err)
+	}
+	release <- struct{}{}
+	if v := <-refreshed; v != "b" {
+		t.Fatalf("expected the refreshed value, got %s", v)
+	}
+}
+
+func TestOpen_DsnFunc(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.db"), filepath.Join(dir, "second.db")
+	openSqlite(t, first, "first")
+	openSqlite(t, second, "second")
+
+	var dsn atomic.Value
+	dsn.Store(first)
+	db, err := Open(DBConf{Driver: testDriver, MaxIdleConns: 0, MaxOpenConns: 1, LogMode: "silent"},
+		WithDsnFunc(func(context.Context) (string, error) {
+			return dsn.Load().(string), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := findName(t, db); name != "first" {
+		t.Fatalf("expected first, got %s", name)
+	}
+	// no idle connections are kept, the next query opens a connection with the new dsn.
+	dsn.Store(second)
+	if name := findName(t, db); name != "second" {
+		t.Fatalf("expected second, got %s", name)
+	}
+
+	RegisterDriver("sqlite-dsn-only-test", sqlite.Open)
+	_, err = Open(DBConf{Driver: "sqlite-dsn-only-test"}, WithDsnFunc(func(context.Context) (string, error) {
+		return first, nil
+	}))
+	if err == nil {
+		t.Fatal("expected driver without database/sql driver error")
+	}
+}
@@ -0,0 +1,164 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"github.com/SpectatorNan/gorm-zero/gormc/config"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DriverName is the name sqlite is registered with in config.RegisterDriver.
+const DriverName = "sqlite"
+
+func init() {
+	config.RegisterDriver(DriverName, sqlite.Open)
+	config.RegisterConnDriver(DriverName, &sqlite3.SQLiteDriver{}, func(conn gorm.ConnPool, dsn string) gorm.Dialector {
+		return &sqlite.Dialector{DSN: dsn, Conn: conn}
+	})
+}
+
+type Sqlite struct {
+	Path            string        // 数据库文件路径, :memory: 为内存数据库
+	JournalMode     string        `json:",default=WAL,options=DELETE|TRUNCATE|PERSIST|MEMORY|WAL|OFF"` // 日志模式
+	BusyTimeout     int           `json:",default=5000"`                                               // 锁等待超时, 毫秒
+	ForeignKeys     bool          `json:",default=true"`                                               // 是否开启外键约束
+	SharedCache     bool          `json:",default=false"`                                              // 是否开启共享缓存
+	Config          string        `json:",optional"`                                                   // 高级配置
+	MaxIdleConns    int           `json:",default=10"`                                                 // 空闲中的最大连接数
+	MaxOpenConns    int           `json:",default=10"`                                                 // 打开到数据库的最大连接数
+	ConnMaxLifetime time.Duration `json:",default=1h"`                                                 // 连接可复用的最大时间
+	ConnMaxIdleTime time.Duration `json:",default=10m"`                                                // 连接最大空闲时间
+	LogMode         string        `json:",default=dev,options=dev|test|prod|silent"`
+	LogColorful     bool          `json:",default=false"` // 是否开启日志高亮
+	SlowThreshold   int64         `json:",default=1000"`
+}
+
+func (m *Sqlite) Dsn() string {
+	params := url.Values{}
+	if len(m.JournalMode) > 0 {
+		params.Set("_journal_mode", m.JournalMode)
+	}
+	if m.BusyTimeout > 0 {
+		params.Set("_busy_timeout", fmt.Sprintf("%d", m.BusyTimeout))
+	}
+	if m.ForeignKeys {
+		params.Set("_foreign_keys", "1")
+	} else {
+		params.Set("_foreign_keys", "0")
+	}
+	if m.SharedCache {
+		params.Set("cache", "shared")
+	}
+
+	query := params.Encode()
+	if len(m.Config) > 0 {
+		query += "&" + m.Config
+	}
+	// escape ? and # so a path can't be mistaken for the query.
+	return "file:" + (&url.URL{Path: m.Path}).EscapedPath() + "?" + query
+}
+
+// Validate reports every invalid field of m.
+func (m *Sqlite) Validate() error {
+	var errs []error
+	if len(m.Path) == 0 {
+		errs = append(errs, errors.New("sqlite Path is empty"))
+	}
+	switch strings.ToUpper(m.JournalMode) {
+	case "", "DELETE", "TRUNCATE", "PERSIST", "MEMORY", "WAL", "OFF":
+	default:
+		errs = append(errs, fmt.Errorf("sqlite JournalMode %q is invalid", m.JournalMode))
+	}
+	if m.BusyTimeout < 0 {
+		errs = append(errs, fmt.Errorf("sqlite BusyTimeout %d is negative", m.BusyTimeout))
+	}
+	if _, err := url.ParseQuery(m.Config); err != nil {
+		errs = append(errs, fmt.Errorf("sqlite Config is invalid: %w", err))
+	}
+	c := m.DBConf()
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// DBConf returns the driver agnostic config of m.
+// An in-memory database lives only as long as its connections, and without SharedCache every
+// connection opens its own empty one, so it is kept on one connection that never expires.
+// With SharedCache the connections share it, they are kept open but not limited.
+func (m *Sqlite) DBConf() config.DBConf {
+	c := config.DBConf{
+		Driver:          DriverName,
+		Dsn:             m.Dsn(),
+		MaxIdleConns:    m.MaxIdleConns,
+		MaxOpenConns:    m.MaxOpenConns,
+		ConnMaxLifetime: m.ConnMaxLifetime,
+		ConnMaxIdleTime: m.ConnMaxIdleTime,
+		LogMode:         m.LogMode,
+		LogColorful:     m.LogColorful,
+		SlowThreshold:   m.SlowThreshold,
+	}
+	if m.inMemory() {
+		if !m.SharedCache {
+			c.MaxOpenConns = 1
+		}
+		c.MaxIdleConns = max(c.MaxIdleConns, 1)
+		c.ConnMaxLifetime, c.ConnMaxIdleTime = 0, 0
+	}
+	return c
+}
+
+// inMemory reports whether m is an in-memory database.
+func (m *Sqlite) inMemory() bool {
+	if m.Path == ":memory:" {
+		return true
+	}
+	params, err := url.ParseQuery(m.Config)
+	return err == nil && params.Get("mode") == "memory"
+}
+
+func (m *Sqlite) GetGormLogMode() logger.LogLevel {
+	return config.OverwriteGormLogMode(m.LogMode)
+}
+
+func (m *Sqlite) GetSlowThreshold() time.Duration {
+	return time.Duration(m.SlowThreshold) * time.Millisecond
+}
+func (m *Sqlite) GetColorful() bool {
+	return m.LogColorful
+}
+
+// Connect opens m, by default with the go-zero logger and the tracing plugin.
+func Connect(m Sqlite, opts ...config.Option) (*gorm.DB, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return config.Open(m.DBConf(), opts...)
+}
+
+// ConnectWithConfig opens m with cfg as the base gorm config.
+func ConnectWithConfig(m Sqlite, cfg *gorm.Config, opts ...config.Option) (*gorm.DB, error) {
+	return Connect(m, append([]config.Option{config.WithGormConfig(cfg)}, opts...)...)
+}
+
+// ConnectReloadable opens m like Connect, apply changes of m with Reload.
+func ConnectReloadable(m Sqlite, opts ...config.Option) (*config.ReloadableDB, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return config.OpenReloadable(m.DBConf(), opts...)
+}
+
+// Reload applies m to r, e.g. in the callback of a config.ConfigWatcher.
+func Reload(r *config.ReloadableDB, m Sqlite) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	return r.Reload(m.DBConf())
+}
@@ -0,0 +1,161 @@
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/conf"
+)
+
+func TestConnect(t *testing.T) {
+	var m Sqlite
+	err := conf.LoadFromYamlBytes([]byte("Path: "+filepath.Join(t.TempDir(), "app.db")+"\nLogMode: silent"), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Connect(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.Config.Plugins["gorm-zero-tracing-plugin"]; !ok {
+		t.Fatal("expected tracing plugin")
+	}
+
+	var journalMode string
+	db.Raw("PRAGMA journal_mode").Scan(&journalMode)
+	if !strings.EqualFold(journalMode, "wal") {
+		t.Errorf("expected wal journal mode, got %s", journalMode)
+	}
+	var foreignKeys, busyTimeout int
+	db.Raw("PRAGMA foreign_keys").Scan(&foreignKeys)
+	db.Raw("PRAGMA busy_timeout").Scan(&busyTimeout)
+	if foreignKeys != 1 || busyTimeout != 5000 {
+		t.Errorf("expected foreign keys on and busy timeout 5000, got %d %d", foreignKeys, busyTimeout)
+	}
+}
+
+func TestConnectEmptyPath(t *testing.T) {
+	if _, err := Connect(Sqlite{}); err == nil {
+		t.Fatal("expected empty path error")
+	}
+}
+
+func TestDsn(t *testing.T) {
+	m := Sqlite{Path: ":memory:", SharedCache: true, Config: "_txlock=immediate"}
+	want := "file::memory:?_foreign_keys=0&cache=shared&_txlock=immediate"
+	if dsn := m.Dsn(); dsn != want {
+		t.Fatalf("expected %s, got %s", want, dsn)
+	}
+}
+
+func TestSqlite_Validate(t *testing.T) {
+	m := Sqlite{JournalMode: "fast", BusyTimeout: -1, Config: "%zz"}
+	err := m.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"Path", "JournalMode", "BusyTimeout", "Config"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error about %s, got %v", want, err)
+		}
+	}
+}
+
+func TestConnectEscapedPath(t *testing.T) {
+	m := Sqlite{Path: filepath.Join(t.TempDir(), "what?#.db"), JournalMode: "WAL", ForeignKeys: true, LogMode: "silent"}
+	db, err := Connect(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Exec("CREATE TABLE t (id integer)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(m.Path); err != nil {
+		t.Fatalf("expected the database at %s: %v", m.Path, err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	var m Sqlite
+	err := conf.LoadFromYamlBytes([]byte("Path: "+filepath.Join(t.TempDir(), "app.db")+"\nLogMode: silent"), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ConnectReloadable(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.BusyTimeout = 1000
+	m.MaxOpenConns = 3
+	if err = Reload(r, m); err != nil {
+		t.Fatal(err)
+	}
+	var busyTimeout int
+	r.DB().Raw("PRAGMA busy_timeout").Scan(&busyTimeout)
+	if busyTimeout != 1000 {
+		t.Fatalf("expected the swapped pool to use busy timeout 1000, got %d", busyTimeout)
+	}
+	if sqldb, _ := r.DB().DB(); sqldb.Stats().MaxOpenConnections != 3 {
+		t.Fatal("expected max open conns 3")
+	}
+
+	m.Path = ""
+	if err = Reload(r, m); err == nil {
+		t.Fatal("expected an invalid config to be rejected")
+	}
+}
+
+func TestConnectInMemory(t *testing.T) {
+	m := Sqlite{Path: ":memory:", JournalMode: "MEMORY", MaxIdleConns: 0, MaxOpenConns: 10,
+		ConnMaxLifetime: time.Hour, ConnMaxIdleTime: time.Minute, LogMode: "silent"}
+	db, err := Connect(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type user struct {
+		ID   int64
+		Name string
+	}
+	if err = db.AutoMigrate(&user{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Create(&user{Name: "alice"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var count int64
+			if err := db.Model(&user{}).Count(&count).Error; err != nil {
+				errs <- err
+			} else if count != 1 {
+				errs <- fmt.Errorf("expected 1 user, got %d", count)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	c := m.DBConf()
+	if c.MaxOpenConns != 1 || c.MaxIdleConns != 1 || c.ConnMaxLifetime != 0 || c.ConnMaxIdleTime != 0 {
+		t.Fatalf("expected one connection that never expires, got %+v", c)
+	}
+	m.SharedCache = true
+	if c = m.DBConf(); c.MaxOpenConns != 10 || c.MaxIdleConns != 1 || c.ConnMaxLifetime != 0 {
+		t.Fatalf("expected shared cache connections to be kept open, got %+v", c)
+	}
+}
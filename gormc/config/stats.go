@@ -0,0 +1,162 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/metric"
+	"gorm.io/gorm"
+)
+
+const defaultPoolStatsInterval = 15 * time.Second
+
+var (
+	metricPoolOpen = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: "gorm",
+		Subsystem: "pool",
+		Name:      "open_connections",
+		Help:      "gorm pool established connections, both in use and idle.",
+		Labels:    []string{"db", "replica"},
+	})
+	metricPoolInUse = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: "gorm",
+		Subsystem: "pool",
+		Name:      "in_use_connections",
+		Help:      "gorm pool connections currently in use.",
+		Labels:    []string{"db", "replica"},
+	})
+	metricPoolIdle = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: "gorm",
+		Subsystem: "pool",
+		Name:      "idle_connections",
+		Help:      "gorm pool idle connections.",
+		Labels:    []string{"db", "replica"},
+	})
+	metricPoolWaitCount = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: "gorm",
+		Subsystem: "pool",
+		Name:      "wait_count",
+		Help:      "gorm pool total number of connections waited for.",
+		Labels:    []string{"db", "replica"},
+	})
+	metricPoolWaitDuration = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: "gorm",
+		Subsystem: "pool",
+		Name:      "wait_duration_seconds",
+		Help:      "gorm pool total time blocked waiting for a new connection in seconds.",
+		Labels:    []string{"db", "replica"},
+	})
+)
+
+type (
+	// PoolStats is the sql.DBStats of a connection pool, Replica is empty for the primary.
+	PoolStats struct {
+		Replica string
+		sql.DBStats
+	}
+
+	// PoolStatsOption customizes a PoolStatsCollector.
+	PoolStatsOption func(c *PoolStatsCollector)
+
+	// PoolStatsCollector periodically publishes the pool stats of a database and its replicas
+	// as gauges labelled by the database name. It implements go-zero's service.Service.
+	PoolStatsCollector struct {
+		name     string
+		db       *gorm.DB
+		interval time.Duration
+
+		ctx      context.Context
+		cancel   context.CancelFunc
+		stopOnce sync.Once
+	}
+
+	statser interface {
+		Stats() sql.DBStats
+	}
+)
+
+// NewPoolStatsCollector returns a PoolStatsCollector of db, name labels the metrics.
+func NewPoolStatsCollector(name string, db *gorm.DB, opts ...PoolStatsOption) *PoolStatsCollector {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &PoolStatsCollector{
+		name:     name,
+		db:       db,
+		interval: defaultPoolStatsInterval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithPoolStatsInterval sets the interval between two collections.
+func WithPoolStatsInterval(interval time.Duration) PoolStatsOption {
+	return func(c *PoolStatsCollector) {
+		if interval > 0 {
+			c.interval = interval
+		}
+	}
+}
+
+// Start collects the stats until Stop is called.
+func (c *PoolStatsCollector) Start() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.CollectOnce()
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the collector.
+func (c *PoolStatsCollector) Stop() {
+	c.stopOnce.Do(c.cancel)
+}
+
+// CollectOnce publishes the current stats.
+func (c *PoolStatsCollector) CollectOnce() {
+	for _, s := range c.Stats() {
+		metricPoolOpen.Set(float64(s.OpenConnections), c.name, s.Replica)
+		metricPoolInUse.Set(float64(s.InUse), c.name, s.Replica)
+		metricPoolIdle.Set(float64(s.Idle), c.name, s.Replica)
+		metricPoolWaitCount.Set(float64(s.WaitCount), c.name, s.Replica)
+		metricPoolWaitDuration.Set(s.WaitDuration.Seconds(), c.name, s.Replica)
+	}
+}
+
+// Stats returns the stats of the primary followed by those of the replicas.
+func (c *PoolStatsCollector) Stats() []PoolStats {
+	var stats []PoolStats
+	sqldb, err := c.db.DB()
+	if err != nil {
+		logx.Errorf("pool stats of %s: %v", c.name, err)
+		return nil
+	}
+	stats = append(stats, PoolStats{DBStats: sqldb.Stats()})
+
+	pool := ReplicasOf(c.db)
+	if pool == nil {
+		return stats
+	}
+	for i, name := range pool.Names() {
+		conn, err := pool.Conn(i)
+		if err != nil {
+			logx.Errorf("pool stats of replica %s of %s: %v", name, c.name, err)
+			continue
+		}
+		if s, ok := conn.(statser); ok {
+			stats = append(stats, PoolStats{Replica: name, DBStats: s.Stats()})
+		}
+	}
+	return stats
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/conf"
+)
+
+func TestPoolStatsCollector_Stats(t *testing.T) {
+	db, _ := createReplicatedDB(t, 100)
+	var name string
+	if err := db.Model(&replicaTestUser{}).Select("name").Where("id = ?", 1).Scan(&name).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewPoolStatsCollector("test", db, WithPoolStatsInterval(time.Millisecond))
+	stats := c.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("expected primary and replica stats, got %d", len(stats))
+	}
+	if stats[0].Replica != "" || stats[1].Replica != "replica" {
+		t.Fatalf("unexpected replicas %q %q", stats[0].Replica, stats[1].Replica)
+	}
+	if stats[0].OpenConnections == 0 || stats[1].OpenConnections == 0 {
+		t.Fatalf("expected open connections, got %d %d", stats[0].OpenConnections, stats[1].OpenConnections)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Start()
+		close(done)
+	}()
+	c.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("collector did not stop")
+	}
+}
+
+func TestOpen_ConnLifetime(t *testing.T) {
+	var c DBConf
+	if err := conf.LoadFromYamlBytes([]byte("Driver: "+testDriver+"\nDsn: ':memory:'"), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.ConnMaxLifetime != time.Hour || c.ConnMaxIdleTime != 10*time.Minute {
+		t.Fatalf("unexpected defaults %v %v", c.ConnMaxLifetime, c.ConnMaxIdleTime)
+	}
+
+	c.ConnMaxLifetime = 10 * time.Millisecond
+	db, err := Open(c, WithStdLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqldb, _ := db.DB()
+	if err = sqldb.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	// database/sql runs its connection cleaner at most once a second.
+	deadline := time.Now().Add(3 * time.Second)
+	for sqldb.Stats().MaxLifetimeClosed == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected connections closed by max lifetime")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
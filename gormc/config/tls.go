@@ -0,0 +1,125 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLS modes, named after the libpq sslmode values.
+const (
+	TLSDisable    = "disable"
+	TLSRequire    = "require"
+	TLSVerifyCA   = "verify-ca"
+	TLSVerifyFull = "verify-full"
+)
+
+// TLS configures an encrypted connection to the database.
+type TLS struct {
+	Mode       string `json:",default=disable,options=disable|require|verify-ca|verify-full"` // 校验模式
+	CaFile     string `json:",optional"`                                                      // CA 证书路径
+	CertFile   string `json:",optional"`                                                      // 客户端证书路径
+	KeyFile    string `json:",optional"`                                                      // 客户端私钥路径
+	ServerName string `json:",optional"`                                                      // 校验的服务器名, 默认为连接地址
+}
+
+// Enabled reports whether t requires TLS.
+func (t TLS) Enabled() bool {
+	return len(t.Mode) > 0 && t.Mode != TLSDisable
+}
+
+// Validate reports the invalid fields of t.
+func (t TLS) Validate() error {
+	var errs []error
+	switch t.Mode {
+	case "", TLSDisable, TLSRequire, TLSVerifyCA, TLSVerifyFull:
+	default:
+		errs = append(errs, fmt.Errorf("tls mode %q is not one of disable|require|verify-ca|verify-full", t.Mode))
+	}
+	if (len(t.CertFile) > 0) != (len(t.KeyFile) > 0) {
+		errs = append(errs, errors.New("tls CertFile and KeyFile must be set together"))
+	}
+	return errors.Join(errs...)
+}
+
+// BuildTLSConfig returns the tls.Config of t to connect to host.
+// As with libpq, require verifies the certificate chain like verify-ca when CaFile is set,
+// verify-ca does not check the server name, and verify-full checks it against ServerName or host.
+func (t TLS) BuildTLSConfig(host string) (*tls.Config, error) {
+	if !t.Enabled() {
+		return nil, nil
+	}
+
+	serverName := t.ServerName
+	if len(serverName) == 0 {
+		serverName = host
+	}
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(t.CertFile) > 0 || len(t.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	var roots *x509.CertPool
+	if len(t.CaFile) > 0 {
+		pem, err := os.ReadFile(t.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in CA file")
+		}
+	}
+
+	switch t.Mode {
+	case TLSRequire:
+		if roots == nil {
+			cfg.InsecureSkipVerify = true
+			return cfg, nil
+		}
+		fallthrough
+	case TLSVerifyCA:
+		if roots == nil {
+			var err error
+			if roots, err = x509.SystemCertPool(); err != nil {
+				return nil, fmt.Errorf("load system certificate pool: %w", err)
+			}
+		}
+		// the chain is verified below without the server name.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyChain(cs, roots)
+		}
+	case TLSVerifyFull:
+		cfg.RootCAs = roots
+	default:
+		return nil, fmt.Errorf("unknown tls mode %q", t.Mode)
+	}
+	return cfg, nil
+}
+
+func verifyChain(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("server sent no certificate")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/config/internal/certtest"
+)
+
+func startTLSServer(t *testing.T, files certtest.Files, clientAuth tls.ClientAuthType) string {
+	cert, err := tls.LoadX509KeyPair(files.ServerCertFile, files.ServerKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem, err := os.ReadFile(files.CaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(pem)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuth,
+		ClientCAs:    clientCAs,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			_ = conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func handshake(t *testing.T, addr string, c TLS) error {
+	host, _, _ := net.SplitHostPort(addr)
+	cfg, err := c.BuildTLSConfig(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// client certificate errors are reported by the server after the handshake.
+	_, err = conn.Read(make([]byte, 1))
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+func TestTLS_BuildTLSConfig(t *testing.T) {
+	files := certtest.Generate(t)
+	other := certtest.Generate(t)
+	addr := startTLSServer(t, files, tls.VerifyClientCertIfGiven)
+
+	tests := []struct {
+		name    string
+		tls     TLS
+		wantErr bool
+	}{
+		{"require", TLS{Mode: TLSRequire}, false},
+		{"require with ca", TLS{Mode: TLSRequire, CaFile: files.CaFile, ServerName: "wrong"}, false},
+		{"require with wrong ca", TLS{Mode: TLSRequire, CaFile: other.CaFile}, true},
+		{"verify-ca", TLS{Mode: TLSVerifyCA, CaFile: files.CaFile, ServerName: "wrong"}, false},
+		{"verify-ca with wrong ca", TLS{Mode: TLSVerifyCA, CaFile: other.CaFile}, true},
+		{"verify-full", TLS{Mode: TLSVerifyFull, CaFile: files.CaFile}, false},
+		{"verify-full with server name", TLS{Mode: TLSVerifyFull, CaFile: files.CaFile, ServerName: "localhost"}, false},
+		{"verify-full with wrong server name", TLS{Mode: TLSVerifyFull, CaFile: files.CaFile, ServerName: "wrong"}, true},
+		{"verify-full with wrong ca", TLS{Mode: TLSVerifyFull, CaFile: other.CaFile}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handshake(t, addr, tt.tls)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTLS_ClientCert(t *testing.T) {
+	files := certtest.Generate(t)
+	addr := startTLSServer(t, files, tls.RequireAndVerifyClientCert)
+
+	c := TLS{Mode: TLSVerifyFull, CaFile: files.CaFile}
+	if err := handshake(t, addr, c); err == nil {
+		t.Fatal("expected the server to require a client certificate")
+	}
+	c.CertFile, c.KeyFile = files.ClientCertFile, files.ClientKeyFile
+	if err := handshake(t, addr, c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLS_Invalid(t *testing.T) {
+	if cfg, err := (TLS{Mode: TLSDisable}).BuildTLSConfig("localhost"); cfg != nil || err != nil {
+		t.Fatalf("expected no tls config, got %v %v", cfg, err)
+	}
+	if _, err := (TLS{Mode: "enable"}).BuildTLSConfig("localhost"); err == nil {
+		t.Fatal("expected unknown mode error")
+	}
+	if _, err := (TLS{Mode: TLSVerifyFull, CaFile: "missing.pem"}).BuildTLSConfig("localhost"); err == nil {
+		t.Fatal("expected missing CA file error")
+	}
+	if _, err := (TLS{Mode: TLSRequire, CertFile: "missing.pem"}).BuildTLSConfig("localhost"); err == nil {
+		t.Fatal("expected missing client certificate error")
+	}
+}
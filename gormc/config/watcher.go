@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/conf"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const defaultWatchInterval = 10 * time.Second
+
+type (
+	// ConfigWatcherOption customizes a ConfigWatcher.
+	ConfigWatcherOption func(o *configWatcherOptions)
+
+	configWatcherOptions struct {
+		interval time.Duration
+		confOpts []conf.Option
+	}
+
+	// ConfigWatcher polls a go-zero config file, and calls onChange with the config loaded by conf.Load
+	// whenever the content of the file changes. It implements go-zero's service.Service.
+	ConfigWatcher[T any] struct {
+		path     string
+		onChange func(c T) error
+		opts     configWatcherOptions
+		sum      [sha256.Size]byte
+
+		ctx      context.Context
+		cancel   context.CancelFunc
+		stopOnce sync.Once
+	}
+)
+
+// NewConfigWatcher returns a ConfigWatcher of the config file at path,
+// the current content is considered loaded already.
+func NewConfigWatcher[T any](path string, onChange func(c T) error, opts ...ConfigWatcherOption) *ConfigWatcher[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &ConfigWatcher[T]{
+		path:     path,
+		onChange: onChange,
+		opts: configWatcherOptions{
+			interval: defaultWatchInterval,
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for _, opt := range opts {
+		opt(&w.opts)
+	}
+	if content, err := os.ReadFile(path); err == nil {
+		w.sum = sha256.Sum256(content)
+	}
+	return w
+}
+
+// WithWatchInterval sets the interval between two checks of the file.
+func WithWatchInterval(interval time.Duration) ConfigWatcherOption {
+	return func(o *configWatcherOptions) {
+		if interval > 0 {
+			o.interval = interval
+		}
+	}
+}
+
+// WithConfOptions sets the options of conf.Load, e.g. conf.UseEnv().
+func WithConfOptions(opts ...conf.Option) ConfigWatcherOption {
+	return func(o *configWatcherOptions) {
+		o.confOpts = opts
+	}
+}
+
+// Start checks the file until Stop is called.
+func (w *ConfigWatcher[T]) Start() {
+	ticker := time.NewTicker(w.opts.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := w.CheckOnce(); err != nil {
+				logx.Errorf("reload config %s failed: %v", w.path, err)
+			}
+		}
+	}
+}
+
+// Stop stops the watcher.
+func (w *ConfigWatcher[T]) Stop() {
+	w.stopOnce.Do(w.cancel)
+}
+
+// CheckOnce loads the file and calls onChange if its content changed since the last check.
+// A content that fails to load or apply is not retried until the file changes again.
+func (w *ConfigWatcher[T]) CheckOnce() error {
+	content, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	if sum == w.sum {
+		return nil
+	}
+	w.sum = sum
+
+	var c T
+	if err = conf.Load(w.path, &c, w.opts.confOpts...); err != nil {
+		return err
+	}
+	logx.Infof("config %s changed, reloading", w.path)
+	return w.onChange(c)
+}
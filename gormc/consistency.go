@@ -0,0 +1,222 @@
+package gormc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/config"
+	"gorm.io/gorm"
+)
+
+const callBackRecordWriteName = "gorm-zero:record_write"
+
+type (
+	// WriteTracker remembers the cache keys and tables written within a window,
+	// cache misses on them are read from the primary, so that a lagging replica
+	// never puts stale data into the cache.
+	WriteTracker struct {
+		window    time.Duration
+		mu        sync.Mutex
+		keys      map[string]time.Time
+		tables    map[string]time.Time
+		lastSweep time.Time
+	}
+
+	writeTrackerKey  struct{}
+	writeRecorderKey struct{}
+
+	// writeRecorder collects the tables written by one ExecCtx.
+	writeRecorder struct {
+		mu     sync.Mutex
+		tables []string
+	}
+)
+
+// NewWriteTracker returns a WriteTracker that remembers writes for window.
+func NewWriteTracker(window time.Duration) *WriteTracker {
+	return &WriteTracker{
+		window:    window,
+		keys:      make(map[string]time.Time),
+		tables:    make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// WithReadYourWrites returns a ctx that tracks the writes made with it for window,
+// use it to get read-your-writes within a single request.
+func WithReadYourWrites(ctx context.Context, window time.Duration) context.Context {
+	return context.WithValue(ctx, writeTrackerKey{}, NewWriteTracker(window))
+}
+
+// WithReadYourWrites returns a copy of cc that tracks writes in process for window.
+func (cc CachedConn) WithReadYourWrites(window time.Duration) CachedConn {
+	cc.tracker = NewWriteTracker(window)
+	return cc
+}
+
+// MarkKeys records writes on keys.
+func (t *WriteTracker) MarkKeys(keys ...string) {
+	t.mark(t.keys, keys)
+}
+
+// MarkTables records writes on tables.
+func (t *WriteTracker) MarkTables(tables ...string) {
+	t.mark(t.tables, tables)
+}
+
+// RecentKey reports whether key was written within the window.
+func (t *WriteTracker) RecentKey(key string) bool {
+	return t.recent(t.keys, key)
+}
+
+// RecentTable reports whether table was written within the window.
+func (t *WriteTracker) RecentTable(table string) bool {
+	return t.recent(t.tables, table)
+}
+
+func (t *WriteTracker) hasRecentTables() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.tables) > 0
+}
+
+func (t *WriteTracker) mark(m map[string]time.Time, names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	now := time.Now()
+	expire := now.Add(t.window)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, name := range names {
+		if len(name) > 0 {
+			m[name] = expire
+		}
+	}
+	if now.Sub(t.lastSweep) > t.window {
+		sweepExpired(t.keys, now)
+		sweepExpired(t.tables, now)
+		t.lastSweep = now
+	}
+}
+
+func (t *WriteTracker) recent(m map[string]time.Time, name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	expire, ok := m[name]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expire) {
+		delete(m, name)
+		return false
+	}
+	return true
+}
+
+func sweepExpired(m map[string]time.Time, now time.Time) {
+	for name, expire := range m {
+		if now.After(expire) {
+			delete(m, name)
+		}
+	}
+}
+
+func (r *writeRecorder) add(table string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tables = append(r.tables, table)
+}
+
+// trackers returns the write trackers that apply to ctx.
+func (cc CachedConn) trackers(ctx context.Context) []*WriteTracker {
+	var trackers []*WriteTracker
+	if t, ok := ctx.Value(writeTrackerKey{}).(*WriteTracker); ok {
+		trackers = append(trackers, t)
+	}
+	if cc.tracker != nil {
+		trackers = append(trackers, cc.tracker)
+	}
+	return trackers
+}
+
+// execWithTracking runs exec and records the written keys and tables.
+func (cc CachedConn) execWithTracking(ctx context.Context, exec ExecCtxFn, keys []string) error {
+	db, release, err := cc.dbOf(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	trackers := cc.trackers(ctx)
+	if len(trackers) == 0 {
+		return exec(db.WithContext(ctx))
+	}
+
+	recorder := &writeRecorder{}
+	if err = exec(db.WithContext(context.WithValue(ctx, writeRecorderKey{}, recorder))); err != nil {
+		return err
+	}
+	for _, t := range trackers {
+		for _, key := range keys {
+			t.MarkKeys(cc.tenantKey(ctx, key))
+		}
+		t.MarkTables(recorder.tables...)
+	}
+	return nil
+}
+
+// readCtx returns the ctx used to load key on a cache miss,
+// it reads from the primary if key or any queried table was written recently.
+func (cc CachedConn) readCtx(ctx context.Context, keys ...string) context.Context {
+	trackers := cc.trackers(ctx)
+	if len(trackers) == 0 {
+		return ctx
+	}
+
+	var withTables []*WriteTracker
+	for _, t := range trackers {
+		for _, key := range keys {
+			if t.RecentKey(cc.tenantKey(ctx, key)) {
+				return config.UsePrimary(ctx)
+			}
+		}
+		if t.hasRecentTables() {
+			withTables = append(withTables, t)
+		}
+	}
+	if len(withTables) == 0 {
+		return ctx
+	}
+	return config.UsePrimaryFor(ctx, func(table string) bool {
+		for _, t := range withTables {
+			if t.RecentTable(table) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// registerWriteRecorder records the tables written by ExecCtx.
+func registerWriteRecorder(db *gorm.DB) {
+	if db == nil || db.Callback().Create().Get(callBackRecordWriteName) != nil {
+		return
+	}
+	_ = db.Callback().Create().After("gorm:create").Register(callBackRecordWriteName, recordWrite)
+	_ = db.Callback().Update().After("gorm:update").Register(callBackRecordWriteName, recordWrite)
+	_ = db.Callback().Delete().After("gorm:delete").Register(callBackRecordWriteName, recordWrite)
+	_ = db.Callback().Raw().After("gorm:raw").Register(callBackRecordWriteName, recordWrite)
+}
+
+func recordWrite(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Context == nil || len(db.Statement.Table) == 0 {
+		return
+	}
+	if recorder, ok := db.Statement.Context.Value(writeRecorderKey{}).(*writeRecorder); ok {
+		recorder.add(db.Statement.Table)
+	}
+}
@@ -0,0 +1,118 @@
+package gormc
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/config"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type consistencyUser struct {
+	Id   uint64 `gorm:"column:id;primaryKey"`
+	Name string `gorm:"column:name"`
+}
+
+// createLaggingDB returns a db whose replica never receives the writes of the primary.
+func createLaggingDB(t *testing.T) *gorm.DB {
+	dir := t.TempDir()
+	open := func(path string) *gorm.DB {
+		db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = db.AutoMigrate(&consistencyUser{}); err != nil {
+			t.Fatal(err)
+		}
+		if err = db.Create(&consistencyUser{Id: 1, Name: "old"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	replicaPath := filepath.Join(dir, "replica.db")
+	open(replicaPath)
+	db := open(filepath.Join(dir, "primary.db"))
+
+	_, err := config.UseReplicas(db, []config.ReplicaDialector{
+		{Name: "replica", Dialector: sqlite.Open(replicaPath), Weight: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func updateAndRead(t *testing.T, ctx context.Context, cc CachedConn, key string) string {
+	err := cc.ExecCtx(ctx, func(conn *gorm.DB) error {
+		return conn.Model(&consistencyUser{}).Where("id = ?", 1).Update("name", "new").Error
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var user consistencyUser
+	err = cc.QueryCtx(ctx, &user, key, func(conn *gorm.DB) error {
+		return conn.Take(&user, 1).Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.Name
+}
+
+func TestCachedConn_ReadYourWrites(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("without tracking", func(t *testing.T) {
+		cc := NewNodeConn(createLaggingDB(t), redis.New(miniredis.RunT(t).Addr()))
+		if name := updateAndRead(t, ctx, cc, "user:1"); name != "old" {
+			t.Fatalf("expected stale replica read, got %s", name)
+		}
+	})
+
+	t.Run("in process", func(t *testing.T) {
+		cc := NewNodeConn(createLaggingDB(t), redis.New(miniredis.RunT(t).Addr())).
+			WithReadYourWrites(time.Minute)
+		if name := updateAndRead(t, ctx, cc, "user:1"); name != "new" {
+			t.Fatalf("expected primary read, got %s", name)
+		}
+
+		// another key on the written table is also read from the primary.
+		var user consistencyUser
+		err := cc.QueryCtx(ctx, &user, "user:name:new", func(conn *gorm.DB) error {
+			return conn.Where("name = ?", "new").Take(&user).Error
+		})
+		if err != nil {
+			t.Fatalf("expected primary read by table, got %v", err)
+		}
+	})
+
+	t.Run("in context", func(t *testing.T) {
+		cc := NewNodeConn(createLaggingDB(t), redis.New(miniredis.RunT(t).Addr()))
+		if name := updateAndRead(t, WithReadYourWrites(ctx, time.Minute), cc, "user:1"); name != "new" {
+			t.Fatalf("expected primary read, got %s", name)
+		}
+	})
+}
+
+func TestWriteTracker(t *testing.T) {
+	tracker := NewWriteTracker(50 * time.Millisecond)
+	tracker.MarkKeys("a")
+	tracker.MarkTables("users")
+	if !tracker.RecentKey("a") || !tracker.RecentTable("users") {
+		t.Fatal("expected recent writes")
+	}
+	if tracker.RecentKey("b") || tracker.RecentTable("orders") {
+		t.Fatal("expected no writes on b and orders")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if tracker.RecentKey("a") || tracker.RecentTable("users") {
+		t.Fatal("expected writes to be forgotten after the window")
+	}
+}
@@ -0,0 +1,57 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// Cleaner deletes expired records periodically, it implements go-zero's service.Service.
+type Cleaner struct {
+	store    *Store
+	interval time.Duration
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+}
+
+// NewCleaner returns a Cleaner that cleans store every interval, an hour if interval isn't positive.
+func NewCleaner(store *Store, interval time.Duration) *Cleaner {
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Cleaner{
+		store:    store,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start cleans expired records until Stop is called.
+func (c *Cleaner) Start() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := c.store.Cleanup(c.ctx)
+			if err != nil && c.ctx.Err() == nil {
+				logx.Errorf("idempotency cleanup failed: %v", err)
+			} else if n > 0 {
+				logx.Infof("idempotency cleanup deleted %d expired records", n)
+			}
+		}
+	}
+}
+
+// Stop stops the cleaner.
+func (c *Cleaner) Stop() {
+	c.stopOnce.Do(c.cancel)
+}
@@ -0,0 +1,245 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc"
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultTableName is the table used by Record.
+	DefaultTableName = "idempotency_record"
+
+	defaultRetention       = 24 * time.Hour
+	defaultCachePrefix     = "cache:idempotency:key:"
+	defaultCleanupBatch    = 500
+	defaultCleanupInterval = time.Hour
+)
+
+var (
+	// ErrNotFound is returned when no live record exists for a key.
+	ErrNotFound = gormc.ErrNotFound
+	// ErrRequestMismatch is returned when a key is reused with a different request.
+	ErrRequestMismatch = errors.New("idempotency: key is reused with a different request")
+	// ErrInProgress is returned when another request with the same key is being processed.
+	ErrInProgress = errors.New("idempotency: request with the same key is in progress")
+)
+
+type (
+	// Option customizes a Store.
+	Option func(s *Store)
+
+	// Store records idempotency keys with the request hash and the stored response.
+	Store struct {
+		conn        gormc.CachedConn
+		retention   time.Duration
+		cachePrefix string
+	}
+
+	// Record is the gorm model of the idempotency table.
+	Record struct {
+		Key         string    `gorm:"column:idempotency_key;primaryKey;type:varchar(191)"`
+		RequestHash string    `gorm:"column:request_hash;type:varchar(64);not null"`
+		Response    []byte    `gorm:"column:response"`
+		CreatedAt   time.Time `gorm:"column:created_at"`
+		ExpiresAt   time.Time `gorm:"column:expires_at;index"`
+	}
+)
+
+func (Record) TableName() string {
+	return DefaultTableName
+}
+
+// NewStore returns a Store on conn.
+func NewStore(conn gormc.CachedConn, opts ...Option) *Store {
+	s := &Store{
+		conn:        conn,
+		retention:   defaultRetention,
+		cachePrefix: defaultCachePrefix,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithRetention sets how long a key is remembered.
+func WithRetention(retention time.Duration) Option {
+	return func(s *Store) {
+		if retention > 0 {
+			s.retention = retention
+		}
+	}
+}
+
+// WithCachePrefix sets the prefix of the cache keys.
+func WithCachePrefix(prefix string) Option {
+	return func(s *Store) {
+		s.cachePrefix = prefix
+	}
+}
+
+// AutoMigrate creates or updates the idempotency table.
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Record{})
+}
+
+// HashRequest returns the hex encoded sha256 of the request parts.
+func HashRequest(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the live record of key, or ErrNotFound.
+func (s *Store) Get(ctx context.Context, key string) (*Record, error) {
+	var rec Record
+	err := s.conn.QueryCtx(ctx, &rec, s.cacheKey(key), func(conn *gorm.DB) error {
+		return conn.Where("idempotency_key = ?", key).Take(&rec).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !rec.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return &rec, nil
+}
+
+// Do runs fn once per key. fn runs in the same transaction that records the key,
+// and its response is stored with it. Later calls with the same key and requestHash
+// return the stored response with replayed set to true.
+func (s *Store) Do(ctx context.Context, key, requestHash string,
+	fn func(tx *gorm.DB) ([]byte, error)) (resp []byte, replayed bool, err error) {
+	rec, err := s.Get(ctx, key)
+	switch {
+	case err == nil:
+		if rec.RequestHash != requestHash {
+			return nil, false, ErrRequestMismatch
+		}
+		return rec.Response, true, nil
+	case !errors.Is(err, ErrNotFound):
+		return nil, false, err
+	}
+
+	now := time.Now()
+	rec = &Record{
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.retention),
+	}
+	err = s.conn.TransactCtx(ctx, func(tx *gorm.DB) error {
+		if err := tx.Where("idempotency_key = ? AND expires_at <= ?", key, now).
+			Delete(&Record{}).Error; err != nil {
+			return err
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(rec)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInProgress
+		}
+
+		resp, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		rec.Response = resp
+		return tx.Model(rec).Update("response", resp).Error
+	})
+	if errors.Is(err, ErrInProgress) {
+		// the miss may be a cached placeholder of a key that has completed since.
+		return s.replay(ctx, key, requestHash)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// fn has committed, a failed cache write must not make the caller retry it.
+	s.cacheRecord(ctx, rec)
+	return rec.Response, false, nil
+}
+
+// replay returns the stored response of the recorded key, or ErrInProgress while it has none.
+func (s *Store) replay(ctx context.Context, key, requestHash string) ([]byte, bool, error) {
+	var rec Record
+	err := s.conn.QueryNoCacheCtx(ctx, func(conn *gorm.DB) error {
+		return conn.Where("idempotency_key = ?", key).Take(&rec).Error
+	})
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return nil, false, ErrInProgress
+	case err != nil:
+		return nil, false, err
+	case rec.RequestHash != requestHash:
+		return nil, false, ErrRequestMismatch
+	case rec.Response == nil:
+		return nil, false, ErrInProgress
+	}
+
+	s.cacheRecord(ctx, &rec)
+	return rec.Response, true, nil
+}
+
+// cacheRecord overwrites the possibly cached not found placeholder of rec,
+// if that fails the placeholder is deleted so the next Get reads the table.
+func (s *Store) cacheRecord(ctx context.Context, rec *Record) {
+	key := s.cacheKey(rec.Key)
+	if err := s.conn.SetCacheWithExpireCtx(ctx, key, rec, s.retention); err != nil {
+		logx.WithContext(ctx).Errorf("cache idempotency record %s failed: %v", rec.Key, err)
+		if err = s.conn.DelCacheCtx(ctx, key); err != nil {
+			logx.WithContext(ctx).Errorf("delete cached idempotency record %s failed: %v", rec.Key, err)
+		}
+	}
+}
+
+// Cleanup deletes expired records and returns how many were deleted.
+func (s *Store) Cleanup(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		var keys []string
+		err := s.conn.QueryNoCacheCtx(ctx, func(conn *gorm.DB) error {
+			return conn.Model(&Record{}).Where("expires_at <= ?", time.Now()).
+				Limit(defaultCleanupBatch).Pluck("idempotency_key", &keys).Error
+		})
+		if err != nil {
+			return total, err
+		}
+		if len(keys) == 0 {
+			return total, nil
+		}
+
+		cacheKeys := make([]string, 0, len(keys))
+		for _, key := range keys {
+			cacheKeys = append(cacheKeys, s.cacheKey(key))
+		}
+		var deleted int64
+		err = s.conn.ExecCtx(ctx, func(conn *gorm.DB) error {
+			res := conn.Where("idempotency_key IN ?", keys).Delete(&Record{})
+			deleted = res.RowsAffected
+			return res.Error
+		}, cacheKeys...)
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+		if len(keys) < defaultCleanupBatch {
+			return total, nil
+		}
+	}
+}
+
+func (s *Store) cacheKey(key string) string {
+	return s.cachePrefix + key
+}
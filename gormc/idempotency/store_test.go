@@ -0,0 +1,216 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	logx.Disable()
+}
+
+type payment struct {
+	Id     uint64 `gorm:"column:id;primaryKey"`
+	Amount int64  `gorm:"column:amount"`
+}
+
+func createTestStore(t *testing.T, opts ...Option) (*Store, *gorm.DB, *miniredis.Miniredis) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "idempotency.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.AutoMigrate(&payment{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	r := miniredis.RunT(t)
+	conn := gormc.NewNodeConn(db, redis.New(r.Addr()))
+	return NewStore(conn, opts...), db, r
+}
+
+func TestStore_Do(t *testing.T) {
+	store, db, r := createTestStore(t)
+	ctx := context.Background()
+	hash := HashRequest([]byte("POST /pay"), []byte(`{"amount":100}`))
+
+	var calls int
+	pay := func(tx *gorm.DB) ([]byte, error) {
+		calls++
+		if err := tx.Create(&payment{Amount: 100}).Error; err != nil {
+			return nil, err
+		}
+		return []byte(`{"status":"ok"}`), nil
+	}
+
+	resp, replayed, err := store.Do(ctx, "key-1", hash, pay)
+	if err != nil || replayed || string(resp) != `{"status":"ok"}` {
+		t.Fatalf("unexpected first call result: %s %v %v", resp, replayed, err)
+	}
+	if !r.Exists(defaultCachePrefix + "key-1") {
+		t.Fatal("expected record to be cached")
+	}
+
+	resp, replayed, err = store.Do(ctx, "key-1", hash, pay)
+	if err != nil || !replayed || string(resp) != `{"status":"ok"}` {
+		t.Fatalf("unexpected replay result: %s %v %v", resp, replayed, err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected fn to run once, got %d", calls)
+	}
+
+	_, _, err = store.Do(ctx, "key-1", HashRequest([]byte("other")), pay)
+	if !errors.Is(err, ErrRequestMismatch) {
+		t.Fatalf("expected ErrRequestMismatch, got %v", err)
+	}
+
+	var cnt int64
+	db.Model(&payment{}).Count(&cnt)
+	if cnt != 1 {
+		t.Fatalf("expected 1 payment, got %d", cnt)
+	}
+}
+
+func TestStore_DoRollback(t *testing.T) {
+	store, db, _ := createTestStore(t)
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	_, _, err := store.Do(ctx, "key-2", "hash", func(tx *gorm.DB) ([]byte, error) {
+		if err := tx.Create(&payment{Amount: 1}).Error; err != nil {
+			return nil, err
+		}
+		return nil, boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected boom, got %v", err)
+	}
+
+	var cnt int64
+	db.Model(&Record{}).Count(&cnt)
+	if cnt != 0 {
+		t.Fatalf("expected record to be rolled back, got %d", cnt)
+	}
+
+	resp, replayed, err := store.Do(ctx, "key-2", "hash", func(tx *gorm.DB) ([]byte, error) {
+		return []byte("done"), nil
+	})
+	if err != nil || replayed || string(resp) != "done" {
+		t.Fatalf("expected retry to run, got %s %v %v", resp, replayed, err)
+	}
+}
+
+func TestStore_InProgress(t *testing.T) {
+	store, db, _ := createTestStore(t)
+	ctx := context.Background()
+
+	// the miss is cached, then another instance records the key.
+	if _, err := store.Get(ctx, "key-3"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	db.Create(&Record{Key: "key-3", RequestHash: "hash", ExpiresAt: time.Now().Add(time.Hour)})
+
+	var called bool
+	_, _, err := store.Do(ctx, "key-3", "hash", func(tx *gorm.DB) ([]byte, error) {
+		called = true
+		return nil, nil
+	})
+	if !errors.Is(err, ErrInProgress) || called {
+		t.Fatalf("expected ErrInProgress without calling fn, got %v %v", err, called)
+	}
+
+	// once the other instance has completed, the cached miss must not keep the key in progress.
+	db.Model(&Record{Key: "key-3"}).Update("response", []byte("done"))
+	for i := 0; i < 2; i++ {
+		resp, replayed, err := store.Do(ctx, "key-3", "hash", func(tx *gorm.DB) ([]byte, error) {
+			called = true
+			return nil, nil
+		})
+		if err != nil || !replayed || string(resp) != "done" || called {
+			t.Fatalf("expected the completed response to be replayed, got %s %v %v %v", resp, replayed, err, called)
+		}
+	}
+	if _, _, err = store.Do(ctx, "key-3", "other", nil); !errors.Is(err, ErrRequestMismatch) {
+		t.Fatalf("expected ErrRequestMismatch, got %v", err)
+	}
+}
+
+func TestStore_DoCacheError(t *testing.T) {
+	store, db, r := createTestStore(t)
+	ctx := context.Background()
+
+	resp, replayed, err := store.Do(ctx, "key-5", "hash", func(tx *gorm.DB) ([]byte, error) {
+		// the cache fails once the transaction has committed.
+		r.SetError("cache is down")
+		return []byte("done"), nil
+	})
+	if err != nil || replayed || string(resp) != "done" {
+		t.Fatalf("expected the committed response despite the cache error, got %s %v %v", resp, replayed, err)
+	}
+	var cnt int64
+	db.Model(&Record{}).Where("response IS NOT NULL").Count(&cnt)
+	if cnt != 1 {
+		t.Fatalf("expected the record to be committed, got %d", cnt)
+	}
+}
+
+func TestStore_Cleanup(t *testing.T) {
+	store, db, _ := createTestStore(t, WithRetention(time.Hour))
+	ctx := context.Background()
+
+	db.Create(&Record{Key: "expired", RequestHash: "h", ExpiresAt: time.Now().Add(-time.Minute)})
+	if _, _, err := store.Do(ctx, "live", "h", func(tx *gorm.DB) ([]byte, error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get(ctx, "expired"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected expired record to be not found, got %v", err)
+	}
+
+	n, err := store.Cleanup(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 deleted, got %d %v", n, err)
+	}
+	var keys []string
+	db.Model(&Record{}).Pluck("idempotency_key", &keys)
+	if len(keys) != 1 || keys[0] != "live" {
+		t.Fatalf("unexpected remaining keys: %v", keys)
+	}
+
+	// an expired key can be used again.
+	resp, replayed, err := store.Do(ctx, "expired", "h2", func(tx *gorm.DB) ([]byte, error) {
+		return []byte("new"), nil
+	})
+	if err != nil || replayed || string(resp) != "new" {
+		t.Fatalf("unexpected result: %s %v %v", resp, replayed, err)
+	}
+}
+
+func TestNewCleaner_DefaultInterval(t *testing.T) {
+	store, _, _ := createTestStore(t)
+	c := NewCleaner(store, 0)
+	if c.interval != defaultCleanupInterval {
+		t.Fatalf("expected the default interval, got %v", c.interval)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Start()
+	}()
+	c.Stop()
+	<-done
+}
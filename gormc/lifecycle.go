@@ -0,0 +1,265 @@
+package gormc
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/config"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/proc"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"gorm.io/gorm"
+)
+
+const (
+	inflightPluginName        = "gorm-zero-inflight-plugin"
+	callBackInflightBeginName = "gorm-zero:inflight_begin"
+	callBackInflightEndName   = "gorm-zero:inflight_end"
+
+	defaultDrainTimeout  = 10 * time.Second
+	drainCheckInterval   = 50 * time.Millisecond
+	defaultHealthTimeout = 3 * time.Second
+)
+
+// ErrShuttingDown is returned by Lifecycle.Health once the shutdown has started.
+var ErrShuttingDown = errors.New("database is shutting down")
+
+type (
+	// Flusher flushes a background queue, e.g. of cache invalidations, before the database is closed.
+	Flusher interface {
+		Flush(ctx context.Context) error
+	}
+
+	// FlusherFunc is an adapter to allow the use of ordinary functions as Flusher.
+	FlusherFunc func(ctx context.Context) error
+
+	// LifecycleOption customizes a Lifecycle.
+	LifecycleOption func(l *Lifecycle)
+
+	// Lifecycle shuts a database down gracefully and reports its readiness.
+	// It implements go-zero's service.Service, and also shuts down on process shutdown.
+	// On shutdown, Health fails first, then in-flight queries are drained,
+	// the flushers are flushed and the connection pools are closed.
+	Lifecycle struct {
+		name         string
+		db           *gorm.DB
+		inflight     *inflightPlugin
+		redis        []*redis.Redis
+		flushers     []Flusher
+		drainTimeout time.Duration
+
+		stopping atomic.Bool
+		stopOnce sync.Once
+		done     chan struct{}
+	}
+
+	// inflightPlugin counts the statements being executed on a db.
+	inflightPlugin struct {
+		count atomic.Int64
+	}
+)
+
+// Flush calls f(ctx).
+func (f FlusherFunc) Flush(ctx context.Context) error {
+	return f(ctx)
+}
+
+// NewLifecycle returns a Lifecycle of db, name is used in logs.
+func NewLifecycle(name string, db *gorm.DB, opts ...LifecycleOption) *Lifecycle {
+	l := &Lifecycle{
+		name:         name,
+		db:           db,
+		inflight:     inflightOf(db),
+		drainTimeout: defaultDrainTimeout,
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	proc.AddShutdownListener(l.Stop)
+	return l
+}
+
+// WithHealthRedis checks rds in Health.
+func WithHealthRedis(rds ...*redis.Redis) LifecycleOption {
+	return func(l *Lifecycle) {
+		l.redis = append(l.redis, rds...)
+	}
+}
+
+// WithHealthCache checks the redis nodes of c in Health.
+func WithHealthCache(c cache.CacheConf) LifecycleOption {
+	return func(l *Lifecycle) {
+		for _, node := range c {
+			l.redis = append(l.redis, node.NewRedis())
+		}
+	}
+}
+
+// WithFlushers flushes f on shutdown, after in-flight queries are drained.
+func WithFlushers(f ...Flusher) LifecycleOption {
+	return func(l *Lifecycle) {
+		l.flushers = append(l.flushers, f...)
+	}
+}
+
+// WithDrainTimeout sets how long the shutdown waits for in-flight queries and for the flushers.
+func WithDrainTimeout(timeout time.Duration) LifecycleOption {
+	return func(l *Lifecycle) {
+		if timeout > 0 {
+			l.drainTimeout = timeout
+		}
+	}
+}
+
+// Start blocks until the database is shut down.
+func (l *Lifecycle) Start() {
+	<-l.done
+}
+
+// Stop shuts the database down, it returns once the connection pools are closed.
+func (l *Lifecycle) Stop() {
+	l.stopOnce.Do(l.shutdown)
+}
+
+// Health pings the database, its replicas and the redis nodes, use it in readiness probes.
+func (l *Lifecycle) Health(ctx context.Context) error {
+	if l.stopping.Load() {
+		return ErrShuttingDown
+	}
+
+	var errs []error
+	if err := config.PingDB(ctx, l.db); err != nil {
+		errs = append(errs, err)
+	}
+	for _, rds := range l.redis {
+		if !rds.PingCtx(ctx) {
+			errs = append(errs, fmt.Errorf("ping redis %s failed", rds.Addr))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HealthHandler returns an http handler that responds 503 with the reason if Health fails.
+func (l *Lifecycle) HealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), defaultHealthTimeout)
+		defer cancel()
+
+		if err := l.Health(ctx); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("OK"))
+	}
+}
+
+// Inflight returns the number of statements being executed.
+func (l *Lifecycle) Inflight() int64 {
+	return l.inflight.count.Load()
+}
+
+func (l *Lifecycle) shutdown() {
+	defer close(l.done)
+	l.stopping.Store(true)
+	logx.Infof("shutting down database %s", l.name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.drainTimeout)
+	defer cancel()
+	if !l.drain(ctx) {
+		logx.Errorf("database %s still has %d queries in flight after %v, closing anyway",
+			l.name, l.Inflight(), l.drainTimeout)
+	}
+
+	for _, f := range l.flushers {
+		if err := f.Flush(ctx); err != nil {
+			logx.Errorf("flush of database %s failed: %v", l.name, err)
+		}
+	}
+
+	if err := config.CloseDB(l.db); err != nil {
+		logx.Errorf("close database %s failed: %v", l.name, err)
+		return
+	}
+	logx.Infof("database %s is closed", l.name)
+}
+
+// drain waits until no statement is executed and no connection is in use, e.g. by a transaction.
+func (l *Lifecycle) drain(ctx context.Context) bool {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if l.Inflight() <= 0 && !l.connsInUse() {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *Lifecycle) connsInUse() bool {
+	var inUse bool
+	pools := []gorm.ConnPool{l.db.ConnPool}
+	if replicas := config.ReplicasOf(l.db); replicas != nil {
+		for i := range replicas.Names() {
+			if conn, err := replicas.Conn(i); err == nil {
+				pools = append(pools, conn)
+			}
+		}
+	}
+	for _, pool := range pools {
+		if s, ok := pool.(interface{ Stats() sql.DBStats }); ok && s.Stats().InUse > 0 {
+			inUse = true
+		}
+	}
+	return inUse
+}
+
+// inflightOf returns the inflightPlugin of db, it is installed once per db.
+func inflightOf(db *gorm.DB) *inflightPlugin {
+	if p, ok := db.Config.Plugins[inflightPluginName].(*inflightPlugin); ok {
+		return p
+	}
+	p := &inflightPlugin{}
+	if err := db.Use(p); err != nil {
+		logx.Errorf("install %s failed: %v", inflightPluginName, err)
+	}
+	return p
+}
+
+func (p *inflightPlugin) Name() string {
+	return inflightPluginName
+}
+
+func (p *inflightPlugin) Initialize(db *gorm.DB) error {
+	begin := func(*gorm.DB) { p.count.Add(1) }
+	end := func(*gorm.DB) { p.count.Add(-1) }
+
+	cb := db.Callback()
+	errs := []error{
+		cb.Create().Before("*").Register(callBackInflightBeginName, begin),
+		cb.Create().After("*").Register(callBackInflightEndName, end),
+		cb.Query().Before("*").Register(callBackInflightBeginName, begin),
+		cb.Query().After("*").Register(callBackInflightEndName, end),
+		cb.Update().Before("*").Register(callBackInflightBeginName, begin),
+		cb.Update().After("*").Register(callBackInflightEndName, end),
+		cb.Delete().Before("*").Register(callBackInflightBeginName, begin),
+		cb.Delete().After("*").Register(callBackInflightEndName, end),
+		cb.Row().Before("*").Register(callBackInflightBeginName, begin),
+		cb.Row().After("*").Register(callBackInflightEndName, end),
+		cb.Raw().Before("*").Register(callBackInflightBeginName, begin),
+		cb.Raw().After("*").Register(callBackInflightEndName, end),
+	}
+	return errors.Join(errs...)
+}
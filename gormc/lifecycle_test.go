@@ -0,0 +1,129 @@
+package gormc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newLifecycleDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "lifecycle.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&consistencyUser{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestLifecycle_Health(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := NewLifecycle("users", newLifecycleDB(t), WithHealthRedis(redis.New(mr.Addr())))
+	defer l.Stop()
+
+	ctx := context.Background()
+	if err := l.Health(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	l.HealthHandler()(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	mr.Close()
+	if err := l.Health(ctx); err == nil {
+		t.Fatal("expected redis to be unhealthy")
+	}
+	rec = httptest.NewRecorder()
+	l.HealthHandler()(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+}
+
+func TestLifecycle_Shutdown(t *testing.T) {
+	db := newLifecycleDB(t)
+	var flushed bool
+	l := NewLifecycle("users", db, WithDrainTimeout(5*time.Second), WithFlushers(FlusherFunc(func(ctx context.Context) error {
+		flushed = true
+		return db.Create(&consistencyUser{Id: 2, Name: "flushed"}).Error
+	})))
+
+	var inflight int64
+	err := db.Callback().Query().After("gorm:query").Register("test:inflight", func(*gorm.DB) {
+		inflight = l.Inflight()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user consistencyUser
+	db.Find(&user)
+	if inflight != 1 || l.Inflight() != 0 {
+		t.Fatalf("expected 1 query in flight, got %d", inflight)
+	}
+
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		l.Start()
+	}()
+	<-started
+
+	tx := db.Begin()
+	stopped := make(chan struct{})
+	go func() {
+		l.Stop()
+		close(stopped)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if err = l.Health(context.Background()); !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("expected ErrShuttingDown, got %v", err)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("expected the shutdown to wait for the transaction")
+	default:
+	}
+	if err = tx.Create(&consistencyUser{Id: 1, Name: "tx"}).Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the shutdown to finish")
+	}
+	if !flushed {
+		t.Fatal("expected the flusher to run before closing")
+	}
+	if sqldb, _ := db.DB(); sqldb.Ping() == nil {
+		t.Fatal("expected the pool to be closed")
+	}
+}
+
+func TestLifecycle_DrainTimeout(t *testing.T) {
+	db := newLifecycleDB(t)
+	l := NewLifecycle("users", db, WithDrainTimeout(100*time.Millisecond))
+	db.Begin()
+
+	start := time.Now()
+	l.Stop()
+	if time.Since(start) > time.Second {
+		t.Fatal("expected the shutdown to give up after the drain timeout")
+	}
+	if sqldb, _ := db.DB(); sqldb.Ping() == nil {
+		t.Fatal("expected the pool to be closed")
+	}
+}
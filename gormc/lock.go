@@ -0,0 +1,238 @@
+package gormc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/hash"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"github.com/zeromicro/go-zero/core/stringx"
+	"github.com/zeromicro/go-zero/core/threading"
+)
+
+// lockRetryInterval is the interval between two attempts to acquire a held lock.
+const lockRetryInterval = 50 * time.Millisecond
+
+var (
+	// ErrNoLocker is returned by WithLockCtx when the CachedConn has no Locker.
+	ErrNoLocker = errors.New("gormc: no locker configured")
+	// ErrLockLost is returned by WithLockCtx when the lock could not be renewed while fn was running.
+	ErrLockLost = errors.New("gormc: lock lost")
+)
+
+type (
+	// Lock is a distributed mutex, *redis.RedisLock satisfies it.
+	// AcquireCtx on a lock already held by the same Lock extends its expiry.
+	Lock interface {
+		AcquireCtx(ctx context.Context) (bool, error)
+		ReleaseCtx(ctx context.Context) (bool, error)
+		SetExpire(seconds int)
+	}
+
+	// Locker creates a Lock for the given key.
+	Locker interface {
+		NewLock(key string) Lock
+	}
+
+	redisLocker struct {
+		dispatcher *hash.ConsistentHash
+	}
+
+	memoryLocker struct {
+		mu    sync.Mutex
+		locks map[string]memoryLockEntry
+	}
+
+	memoryLockEntry struct {
+		owner    string
+		expireAt time.Time
+	}
+
+	memoryLock struct {
+		locker  *memoryLocker
+		key     string
+		id      string
+		seconds int
+	}
+)
+
+// NewRedisLocker returns a Locker backed by go-zero's redis.RedisLock.
+func NewRedisLocker(rds *redis.Redis) Locker {
+	dispatcher := hash.NewConsistentHash()
+	dispatcher.Add(rds)
+	return redisLocker{dispatcher: dispatcher}
+}
+
+// newClusterLocker returns a Locker on the redis nodes of c,
+// the node of a key is chosen the same way as the cache does.
+func newClusterLocker(c cache.ClusterConf) Locker {
+	dispatcher := hash.NewConsistentHash()
+	for _, node := range c {
+		dispatcher.AddWithWeight(redis.MustNewRedis(node.RedisConf), node.Weight)
+	}
+	return redisLocker{dispatcher: dispatcher}
+}
+
+func (l redisLocker) NewLock(key string) Lock {
+	rds, _ := l.dispatcher.Get(key)
+	return redis.NewRedisLock(rds.(*redis.Redis), key)
+}
+
+// NewMemoryLocker returns a process local Locker, mostly used in tests.
+func NewMemoryLocker() Locker {
+	return &memoryLocker{
+		locks: make(map[string]memoryLockEntry),
+	}
+}
+
+func (l *memoryLocker) NewLock(key string) Lock {
+	return &memoryLock{
+		locker: l,
+		key:    key,
+		id:     stringx.Randn(16),
+	}
+}
+
+func (l *memoryLock) AcquireCtx(_ context.Context) (bool, error) {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := l.locker.locks[l.key]
+	if ok && entry.owner != l.id && now.Before(entry.expireAt) {
+		return false, nil
+	}
+	l.locker.locks[l.key] = memoryLockEntry{
+		owner:    l.id,
+		expireAt: now.Add(time.Duration(l.seconds) * time.Second),
+	}
+	return true, nil
+}
+
+func (l *memoryLock) ReleaseCtx(_ context.Context) (bool, error) {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+
+	entry, ok := l.locker.locks[l.key]
+	if !ok || entry.owner != l.id {
+		return false, nil
+	}
+	delete(l.locker.locks, l.key)
+	return true, nil
+}
+
+func (l *memoryLock) SetExpire(seconds int) {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+	l.seconds = seconds
+}
+
+// WithLocker returns a copy of cc that uses locker in WithLockCtx.
+func (cc CachedConn) WithLocker(locker Locker) CachedConn {
+	cc.locker = locker
+	return cc
+}
+
+// WithLockCtx runs fn while holding the distributed lock of lockKey.
+// It waits until the lock is acquired or ctx is done, renews the lock every ttl/3
+// while fn is running, and releases it when fn returns or panics.
+// If a renewal fails or the lock is taken by another holder, the ctx of fn is canceled
+// and ErrLockLost is returned, joined with the error of fn.
+func (cc CachedConn) WithLockCtx(ctx context.Context, lockKey string, ttl time.Duration,
+	fn func(ctx context.Context) error) (err error) {
+	ctx, span := startSpan(ctx, "WithLock")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	if cc.locker == nil {
+		return ErrNoLocker
+	}
+
+	lock := cc.locker.NewLock(cc.tenantKey(ctx, lockKey))
+	lock.SetExpire(int(math.Ceil(math.Max(ttl.Seconds(), 1))))
+	if err = acquireLock(ctx, lock); err != nil {
+		return err
+	}
+
+	fnCtx, lost := context.WithCancelCause(ctx)
+	renewCtx, stop := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	threading.GoSafe(func() {
+		defer wg.Done()
+		renewLock(renewCtx, lock, lockKey, ttl, lost)
+	})
+	defer func() {
+		stop()
+		wg.Wait()
+		if cause := context.Cause(fnCtx); errors.Is(cause, ErrLockLost) {
+			err = errors.Join(cause, err)
+		}
+		lost(nil)
+		if _, e := lock.ReleaseCtx(context.WithoutCancel(ctx)); e != nil {
+			logx.WithContext(ctx).Errorf("failed to release lock %s: %v", lockKey, e)
+		}
+	}()
+
+	return fn(fnCtx)
+}
+
+func acquireLock(ctx context.Context, lock Lock) error {
+	ticker := time.NewTicker(lockRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := lock.AcquireCtx(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// renewLock renews lock until ctx is done, it calls lost with ErrLockLost when a renewal fails.
+func renewLock(ctx context.Context, lock Lock, lockKey string, ttl time.Duration, lost context.CancelCauseFunc) {
+	interval := ttl / 3
+	if interval <= 0 {
+		interval = time.Second / 3
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := lock.AcquireCtx(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logx.WithContext(ctx).Errorf("failed to renew lock %s: %v", lockKey, err)
+				lost(fmt.Errorf("%w: %s: %w", ErrLockLost, lockKey, err))
+				return
+			}
+			if !ok {
+				logx.WithContext(ctx).Errorf("lock %s was lost before the operation finished", lockKey)
+				lost(fmt.Errorf("%w: %s", ErrLockLost, lockKey))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package gormc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+)
+
+func TestCachedConn_WithLockCtx(t *testing.T) {
+	cc := NewConnWithCache(nil, nil).WithLocker(NewMemoryLocker())
+	ctx := context.Background()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		running int
+		maxRun  int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := cc.WithLockCtx(ctx, "stock:1", time.Second, func(ctx context.Context) error {
+				mu.Lock()
+				running++
+				if running > maxRun {
+					maxRun = running
+				}
+				mu.Unlock()
+				time.Sleep(10 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxRun != 1 {
+		t.Fatalf("expected exclusive access, got %d concurrent runs", maxRun)
+	}
+}
+
+func TestCachedConn_WithLockCtxReleaseOnPanic(t *testing.T) {
+	cc := NewConnWithCache(nil, nil).WithLocker(NewMemoryLocker())
+	ctx := context.Background()
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		_ = cc.WithLockCtx(ctx, "key", time.Minute, func(ctx context.Context) error {
+			panic("boom")
+		})
+	}()
+
+	timeout, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if err := cc.WithLockCtx(timeout, "key", time.Minute, func(ctx context.Context) error {
+		return nil
+	}); err != nil {
+		t.Fatalf("expected lock to be released after panic, got %v", err)
+	}
+}
+
+func TestCachedConn_WithLockCtxRenew(t *testing.T) {
+	cc := NewConnWithCache(nil, nil).WithLocker(NewMemoryLocker())
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- cc.WithLockCtx(ctx, "key", time.Second, func(ctx context.Context) error {
+			close(started)
+			time.Sleep(1500 * time.Millisecond)
+			return nil
+		})
+	}()
+	<-started
+
+	// the lock outlives its ttl because it is renewed.
+	time.Sleep(1200 * time.Millisecond)
+	timeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err := cc.WithLockCtx(timeout, "key", time.Second, func(ctx context.Context) error {
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected lock to be held, got %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCachedConn_WithLockCtxRedis(t *testing.T) {
+	r := miniredis.RunT(t)
+	rds := redis.New(r.Addr())
+	cc := NewNodeConn(nil, rds)
+	ctx := context.Background()
+
+	var called bool
+	err := cc.WithLockCtx(ctx, "lock:order:1", time.Second, func(ctx context.Context) error {
+		called = true
+		if !r.Exists("lock:order:1") {
+			t.Error("expected lock key in redis")
+		}
+		return nil
+	})
+	if err != nil || !called {
+		t.Fatalf("expected fn to be called, got %v", err)
+	}
+	if r.Exists("lock:order:1") {
+		t.Fatal("expected lock key to be released")
+	}
+
+	boom := errors.New("boom")
+	err = cc.WithLockCtx(ctx, "lock:order:1", time.Second, func(ctx context.Context) error {
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected fn error, got %v", err)
+	}
+}
+
+func TestCachedConn_WithLockCtxLost(t *testing.T) {
+	r := miniredis.RunT(t)
+	cc := NewNodeConn(nil, redis.New(r.Addr()))
+
+	err := cc.WithLockCtx(context.Background(), "lock:order:1", time.Second, func(ctx context.Context) error {
+		// the key expires and another holder takes the lock.
+		r.FastForward(2 * time.Second)
+		r.Set("lock:order:1", "other")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+			t.Error("expected ctx to be canceled when the lock is lost")
+			return nil
+		}
+	})
+	if !errors.Is(err, ErrLockLost) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected ErrLockLost, got %v", err)
+	}
+	if v, _ := r.Get("lock:order:1"); v != "other" {
+		t.Fatalf("expected the lock of the other holder to be kept, got %q", v)
+	}
+}
+
+func TestCachedConn_WithLockCtxNoLocker(t *testing.T) {
+	cc := NewConnWithCache(nil, nil)
+	err := cc.WithLockCtx(context.Background(), "key", time.Second, func(ctx context.Context) error {
+		return nil
+	})
+	if !errors.Is(err, ErrNoLocker) {
+		t.Fatalf("expected ErrNoLocker, got %v", err)
+	}
+}
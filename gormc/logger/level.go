@@ -0,0 +1,39 @@
+package logger
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+
+	gormLogger "gorm.io/gorm/logger"
+)
+
+type levelCtxKey struct{}
+
+// WithLevel returns a ctx whose statements are logged at level by the zero logger,
+// e.g. gormLogger.Info to log the sql of a single request. A level below the one of the logger is ignored.
+func WithLevel(ctx context.Context, level gormLogger.LogLevel) context.Context {
+	return context.WithValue(ctx, levelCtxKey{}, level)
+}
+
+func levelFromContext(ctx context.Context) (gormLogger.LogLevel, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	level, ok := ctx.Value(levelCtxKey{}).(gormLogger.LogLevel)
+	return level, ok
+}
+
+// DebugMiddleware returns a go-zero rest middleware that logs all the sql of a request
+// if its header equals token. An empty token never matches, keep the token secret.
+func DebugMiddleware(header, token string) func(next http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			value := r.Header.Get(header)
+			if token != "" && subtle.ConstantTimeCompare([]byte(value), []byte(token)) == 1 {
+				r = r.WithContext(WithLevel(r.Context(), gormLogger.Info))
+			}
+			next(w, r)
+		}
+	}
+}
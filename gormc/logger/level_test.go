@@ -0,0 +1,69 @@
+package logger
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func TestZeroLog_WithLevel(t *testing.T) {
+	var buf strings.Builder
+	logx.SetWriter(logx.NewWriter(&buf))
+	defer logx.Reset()
+
+	log := NewZeroLog(gormLogger.Config{LogLevel: gormLogger.Warn})
+	traceFc := func() (sql string, rowsAffected int64) {
+		return "select * from test", 1
+	}
+
+	log.Trace(context.Background(), time.Now(), traceFc, nil)
+	log.Trace(WithLevel(context.Background(), gormLogger.Silent), time.Now().Add(-time.Second), traceFc, nil)
+	if buf.Len() != 0 {
+		t.Fatalf("expected no log, got %s", buf.String())
+	}
+	log.Trace(WithLevel(context.Background(), gormLogger.Info), time.Now(), traceFc, nil)
+	if !strings.Contains(buf.String(), "select * from test") {
+		t.Fatal("expected the level of ctx to log the sql")
+	}
+}
+
+func TestDebugMiddleware(t *testing.T) {
+	var level gormLogger.LogLevel
+	handler := DebugMiddleware("X-Debug-Sql", "secret")(func(w http.ResponseWriter, r *http.Request) {
+		level, _ = levelFromContext(r.Context())
+	})
+
+	for _, c := range []struct {
+		token string
+		want  gormLogger.LogLevel
+	}{
+		{token: "", want: 0},
+		{token: "wrong", want: 0},
+		{token: "secret", want: gormLogger.Info},
+	} {
+		level = 0
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.token != "" {
+			req.Header.Set("X-Debug-Sql", c.token)
+		}
+		handler(httptest.NewRecorder(), req)
+		if level != c.want {
+			t.Fatalf("expected level %d with token %q, got %d", c.want, c.token, level)
+		}
+	}
+
+	level = 0
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	DebugMiddleware("X-Debug-Sql", "")(func(w http.ResponseWriter, r *http.Request) {
+		level, _ = levelFromContext(r.Context())
+	})(httptest.NewRecorder(), req)
+	if level != 0 {
+		t.Fatal("expected an empty token to never match")
+	}
+}
@@ -7,10 +7,44 @@ import (
 	"github.com/SpectatorNan/gorm-zero/gormc/utils"
 	"github.com/zeromicro/go-zero/core/logx"
 	gormLogger "gorm.io/gorm/logger"
+	"sync/atomic"
 	"time"
 )
 
-func NewZeroLog(config gormLogger.Config) gormLogger.Interface {
+// Reloadable is a gorm logger whose level and slow threshold can be changed at runtime.
+type Reloadable interface {
+	SetLogLevel(level gormLogger.LogLevel)
+	SetSlowThreshold(threshold time.Duration)
+}
+
+// Option customizes the logger of NewZeroLog.
+type Option func(l *logger)
+
+// WithStructured logs sql as logx fields: sql, duration, rows, caller, error, table and operation,
+// instead of formatting them into the message. Colorful is ignored.
+func WithStructured() Option {
+	return func(l *logger) {
+		l.structured = true
+	}
+}
+
+// WithSampling samples the statements logged at Info level, see SampleRate and SampleFirst.
+// Errors and slow statements are always logged, and so are the statements of a ctx raised by WithLevel.
+func WithSampling(opts ...SampleOption) Option {
+	return func(l *logger) {
+		l.sampler = newSampler(opts...)
+	}
+}
+
+// WithRedactor redacts the sql of logs with r, see NewRedactor.
+// The tracing plugin redacts the gorm.sql attribute with the redactor of the db logger too.
+func WithRedactor(r SqlRedactor) Option {
+	return func(l *logger) {
+		l.redactor = r
+	}
+}
+
+func NewZeroLog(config gormLogger.Config, opts ...Option) gormLogger.Interface {
 	var (
 		infoStr      = "%s\n[info] "
 		warnStr      = "%s\n[warn] "
@@ -29,15 +63,23 @@ func NewZeroLog(config gormLogger.Config) gormLogger.Interface {
 		traceErrStr = gormLogger.RedBold + "%s " + gormLogger.MagentaBold + "%s\n" + gormLogger.Reset + gormLogger.Yellow + "[%.3fms] " + gormLogger.BlueBold + "[rows:%v]" + gormLogger.Reset + " %s"
 	}
 
-	return &logger{
-		Config:       config,
-		infoStr:      infoStr,
-		warnStr:      warnStr,
-		errStr:       errStr,
-		traceStr:     traceStr,
-		traceWarnStr: traceWarnStr,
-		traceErrStr:  traceErrStr,
+	l := &logger{
+		Config:        config,
+		logLevel:      new(atomic.Int32),
+		slowThreshold: new(atomic.Int64),
+		infoStr:       infoStr,
+		warnStr:       warnStr,
+		errStr:        errStr,
+		traceStr:      traceStr,
+		traceWarnStr:  traceWarnStr,
+		traceErrStr:   traceErrStr,
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.SetLogLevel(config.LogLevel)
+	l.SetSlowThreshold(config.SlowThreshold)
+	return l
 }
 
 type logger struct {
@@ -45,57 +87,119 @@ type logger struct {
 	gormLogger.Config
 	infoStr, warnStr, errStr            string
 	traceStr, traceErrStr, traceWarnStr string
+	structured                          bool
+	redactor                            SqlRedactor
+	sampler                             *sampler
+
+	// LogLevel and SlowThreshold of Config are only read by NewZeroLog, these can be reloaded.
+	logLevel      *atomic.Int32
+	slowThreshold *atomic.Int64
 }
 
-// LogMode log mode
+// LogMode log mode, the returned logger keeps level when the level of l is reloaded.
 func (l *logger) LogMode(level gormLogger.LogLevel) gormLogger.Interface {
 	newlogger := *l
-	newlogger.LogLevel = level
+	newlogger.logLevel = new(atomic.Int32)
+	newlogger.SetLogLevel(level)
 	return &newlogger
 }
 
+// SetLogLevel changes the level of l, it is safe for concurrent use.
+func (l *logger) SetLogLevel(level gormLogger.LogLevel) {
+	l.logLevel.Store(int32(level))
+}
+
+// SetSlowThreshold changes the slow threshold of l and of the loggers returned by its LogMode.
+func (l *logger) SetSlowThreshold(threshold time.Duration) {
+	l.slowThreshold.Store(int64(threshold))
+}
+
+func (l *logger) level(ctx context.Context) gormLogger.LogLevel {
+	level := gormLogger.LogLevel(l.logLevel.Load())
+	if raised, ok := levelFromContext(ctx); ok && raised > level {
+		return raised
+	}
+	return level
+}
+
+func (l *logger) slow() time.Duration {
+	return time.Duration(l.slowThreshold.Load())
+}
+
+// ParamsFilter implements gorm's ParamsFilter with the redactor of l.
+func (l *logger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.redactor == nil {
+		return sql, params
+	}
+	return l.redactor.ParamsFilter(ctx, sql, params...)
+}
+
+// RedactSql redacts the explained sql with the redactor of l.
+func (l *logger) RedactSql(sql string) string {
+	if l.redactor == nil {
+		return sql
+	}
+	return l.redactor.RedactSql(sql)
+}
+
 func (l *logger) Info(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= gormLogger.Info {
+	if l.level(ctx) >= gormLogger.Info {
 		logx.WithContext(ctx).Infof(l.infoStr+msg, append([]interface{}{utils.FileWithLineNum()}, data...)...)
 	}
 }
 
 func (l *logger) Warn(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= gormLogger.Warn {
+	if l.level(ctx) >= gormLogger.Warn {
 		logx.WithContext(ctx).Slowf(l.warnStr+msg, append([]interface{}{utils.FileWithLineNum()}, data...)...)
 	}
 }
 
 func (l *logger) Error(ctx context.Context, msg string, data ...interface{}) {
-	if l.LogLevel >= gormLogger.Error {
+	if l.level(ctx) >= gormLogger.Error {
 		logx.WithContext(ctx).Errorf(l.errStr+msg, append([]interface{}{utils.FileWithLineNum()}, data...)...)
 	}
 }
 
 func (l *logger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
-	if l.LogLevel <= gormLogger.Silent {
+	level, slowThreshold := l.level(ctx), l.slow()
+	if level <= gormLogger.Silent {
 		return
 	}
 
 	elapsed := time.Since(begin)
+	if l.redactor != nil {
+		explain := fc
+		fc = func() (string, int64) {
+			sql, rows := explain()
+			return l.redactor.RedactSql(sql), rows
+		}
+	}
+	if l.structured {
+		l.traceFields(ctx, elapsed, fc, err, level, slowThreshold)
+		return
+	}
+
 	switch {
-	case err != nil && l.LogLevel >= gormLogger.Error && (!l.IgnoreRecordNotFoundError || !errors.Is(err, gormLogger.ErrRecordNotFound)):
+	case err != nil && level >= gormLogger.Error && (!l.IgnoreRecordNotFoundError || !errors.Is(err, gormLogger.ErrRecordNotFound)):
 		sql, rows := fc()
 		if rows == -1 {
 			logx.WithContext(ctx).Errorf(l.traceErrStr, utils.FileWithLineNum(), err, float64(elapsed.Nanoseconds())/1e6, "-", sql)
 		} else {
 			logx.WithContext(ctx).Errorf(l.traceErrStr, utils.FileWithLineNum(), err, float64(elapsed.Nanoseconds())/1e6, rows, sql)
 		}
-	case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= gormLogger.Warn:
+	case elapsed > slowThreshold && slowThreshold != 0 && level >= gormLogger.Warn:
 		sql, rows := fc()
-		slowLog := fmt.Sprintf("SLOW SQL >= %v", l.SlowThreshold)
+		slowLog := fmt.Sprintf("SLOW SQL >= %v", slowThreshold)
 		if rows == -1 {
 			logx.WithContext(ctx).Slowf(l.traceWarnStr, utils.FileWithLineNum(), slowLog, float64(elapsed.Nanoseconds())/1e6, "-", sql)
 		} else {
 			logx.WithContext(ctx).Slowf(l.traceWarnStr, utils.FileWithLineNum(), slowLog, float64(elapsed.Nanoseconds())/1e6, rows, sql)
 		}
-	case l.LogLevel == gormLogger.Info:
-		sql, rows := fc()
+	case level == gormLogger.Info:
+		sql, rows, ok := l.sampledTrace(ctx, fc)
+		if !ok {
+			return
+		}
 		if rows == -1 {
 			logx.WithContext(ctx).Infof(l.traceStr, utils.FileWithLineNum(), float64(elapsed.Nanoseconds())/1e6, "-", sql)
 		} else {
@@ -103,3 +207,79 @@ func (l *logger) Trace(ctx context.Context, begin time.Time, fc func() (string,
 		}
 	}
 }
+
+// traceFields is the structured Trace, logx reports the caller outside gorm as the caller field.
+func (l *logger) traceFields(ctx context.Context, elapsed time.Duration, fc func() (string, int64), err error,
+	level gormLogger.LogLevel, slowThreshold time.Duration) {
+	isErr := err != nil && level >= gormLogger.Error &&
+		(!l.IgnoreRecordNotFoundError || !errors.Is(err, gormLogger.ErrRecordNotFound))
+	isSlow := elapsed > slowThreshold && slowThreshold != 0 && level >= gormLogger.Warn
+	if !isErr && !isSlow && level != gormLogger.Info {
+		return
+	}
+
+	var (
+		sql  string
+		rows int64
+		ok   bool
+	)
+	if isErr || isSlow {
+		sql, rows = fc()
+	} else if sql, rows, ok = l.sampledTrace(ctx, fc); !ok {
+		return
+	}
+	fields := []logx.LogField{
+		logx.Field("sql", sql),
+		logx.Field("table", utils.SqlTable(sql)),
+		logx.Field("operation", utils.SqlOperation(sql)),
+	}
+	if rows != -1 {
+		fields = append(fields, logx.Field("rows", rows))
+	}
+
+	_, skip := utils.CallerSkip()
+	log := logx.WithContext(ctx).WithCallerSkip(skip).WithDuration(elapsed)
+	switch {
+	case isErr:
+		log.Errorw("sql error", append(fields, logx.Field("error", err))...)
+	case isSlow:
+		log.Sloww(fmt.Sprintf("slow sql >= %v", slowThreshold), fields...)
+	default:
+		log.Infow("sql", fields...)
+	}
+}
+
+// sampledTrace calls fc if the statement is sampled, and logs the counts of the statements
+// skipped in the intervals that have passed.
+func (l *logger) sampledTrace(ctx context.Context, fc func() (string, int64)) (string, int64, bool) {
+	s := l.sampler
+	if raised, ok := levelFromContext(ctx); s == nil || (ok && raised >= gormLogger.Info) {
+		sql, rows := fc()
+		return sql, rows, true
+	}
+	if s.first == 0 {
+		if !s.byRate() {
+			return "", 0, false
+		}
+		sql, rows := fc()
+		return sql, rows, true
+	}
+
+	sql, rows := fc()
+	logged, reports := s.byFingerprint(sql, time.Now())
+	for _, report := range reports {
+		if l.structured {
+			logx.WithContext(ctx).Infow("sql sampled", logx.Field("fingerprint", report.fingerprint),
+				logx.Field("skipped", report.skipped), logx.Field("interval", s.interval.String()))
+		} else {
+			logx.WithContext(ctx).Infof("sql sampled, %d statements like %s were not logged in the last %v",
+				report.skipped, report.fingerprint, s.interval)
+		}
+	}
+	return sql, rows, logged
+}
+
+var (
+	_ Reloadable  = (*logger)(nil)
+	_ SqlRedactor = (*logger)(nil)
+)
@@ -2,8 +2,12 @@ package logger
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"github.com/zeromicro/go-zero/core/logx"
+	"go.opentelemetry.io/otel/trace"
 	gormLogger "gorm.io/gorm/logger"
+	"strings"
 	"testing"
 	"time"
 )
@@ -59,3 +63,95 @@ func TestZeroLog(t *testing.T) {
 	}
 
 }
+
+func TestZeroLog_Reload(t *testing.T) {
+	var buf strings.Builder
+	logx.SetWriter(logx.NewWriter(&buf))
+	defer logx.Reset()
+
+	log := NewZeroLog(gormLogger.Config{LogLevel: gormLogger.Error, SlowThreshold: time.Second})
+	debug := log.LogMode(gormLogger.Info)
+	traceFc := func() (sql string, rowsAffected int64) {
+		return "select * from test", 1
+	}
+	slowBegin := time.Now().Add(-20 * time.Millisecond)
+
+	log.Trace(context.Background(), slowBegin, traceFc, nil)
+	if buf.Len() != 0 {
+		t.Fatalf("expected no log, got %s", buf.String())
+	}
+
+	reloadable := log.(Reloadable)
+	reloadable.SetLogLevel(gormLogger.Warn)
+	reloadable.SetSlowThreshold(10 * time.Millisecond)
+	log.Trace(context.Background(), slowBegin, traceFc, nil)
+	if !strings.Contains(buf.String(), "SLOW SQL >= 10ms") {
+		t.Fatalf("expected slow log, got %s", buf.String())
+	}
+
+	buf.Reset()
+	reloadable.SetLogLevel(gormLogger.Silent)
+	debug.Trace(context.Background(), time.Now(), traceFc, nil)
+	if !strings.Contains(buf.String(), "select * from test") {
+		t.Fatal("expected the LogMode logger to keep its level")
+	}
+}
+
+func TestZeroLog_Structured(t *testing.T) {
+	var buf strings.Builder
+	logx.SetWriter(logx.NewWriter(&buf))
+	defer logx.Reset()
+
+	log := NewZeroLog(gormLogger.Config{LogLevel: gormLogger.Info, SlowThreshold: 10 * time.Millisecond}, WithStructured())
+	traceFc := func() (sql string, rowsAffected int64) {
+		return "SELECT * FROM `users` WHERE id = 1", 1
+	}
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), spanCtx)
+
+	entry := func(exec func()) map[string]interface{} {
+		buf.Reset()
+		exec()
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(buf.String()), &m); err != nil {
+			t.Fatalf("expected a json entry, got %s", buf.String())
+		}
+		return m
+	}
+
+	m := entry(func() { log.Trace(ctx, time.Now(), traceFc, nil) })
+	want := map[string]interface{}{
+		"content":   "sql",
+		"level":     "info",
+		"sql":       "SELECT * FROM `users` WHERE id = 1",
+		"table":     "users",
+		"operation": "select",
+		"rows":      float64(1),
+		"trace":     spanCtx.TraceID().String(),
+	}
+	for k, v := range want {
+		if m[k] != v {
+			t.Errorf("expected %s %v, got %v", k, v, m[k])
+		}
+	}
+	if caller, _ := m["caller"].(string); !strings.HasPrefix(caller, "logger/logger_test.go") {
+		t.Errorf("expected the caller of Trace, got %v", m["caller"])
+	}
+	if _, ok := m["duration"]; !ok {
+		t.Error("expected duration")
+	}
+
+	m = entry(func() { log.Trace(ctx, time.Now().Add(-20*time.Millisecond), traceFc, nil) })
+	if m["level"] != "slow" || m["content"] != "slow sql >= 10ms" {
+		t.Errorf("expected slow log, got %v", m)
+	}
+
+	m = entry(func() { log.Trace(ctx, time.Now(), traceFc, errors.New("boom")) })
+	if m["level"] != "error" || m["error"] != "boom" {
+		t.Errorf("expected error log, got %v", m)
+	}
+}
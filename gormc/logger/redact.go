@@ -0,0 +1,344 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// RedactedValue replaces the redacted values in logs and traces.
+const RedactedValue = "xxxxx"
+
+type (
+	// SqlRedactor redacts statements before they are logged or traced.
+	// gorm calls ParamsFilter before the vars are expanded by Dialector.Explain,
+	// RedactSql is called on the explained sql.
+	SqlRedactor interface {
+		gorm.ParamsFilter
+		RedactSql(sql string) string
+	}
+
+	// RedactOption customizes a Redactor.
+	RedactOption func(r *Redactor)
+
+	// Redactor masks the values bound to sensitive columns, the text matching patterns,
+	// and truncates long statements.
+	Redactor struct {
+		columns       map[string]struct{}
+		patterns      []*regexp.Regexp
+		parameterized bool
+		maxLength     int
+	}
+
+	sqlToken struct {
+		kind  sqlTokenKind
+		text  string
+		index int // var index of a placeholder
+	}
+
+	sqlTokenKind int
+)
+
+const (
+	tokenOther sqlTokenKind = iota
+	tokenIdent
+	tokenKeyword
+	tokenOperator
+	tokenPlaceholder
+)
+
+// keywords that can't be column names, and the ones between a column and its value.
+var (
+	sqlKeywords = map[string]struct{}{
+		"select": {}, "from": {}, "where": {}, "and": {}, "or": {}, "not": {}, "in": {}, "like": {},
+		"ilike": {}, "is": {}, "set": {}, "values": {}, "insert": {}, "into": {}, "update": {},
+		"delete": {}, "limit": {}, "offset": {}, "order": {}, "by": {}, "group": {}, "having": {},
+		"on": {}, "join": {}, "as": {}, "returning": {}, "between": {}, "case": {}, "when": {},
+		"then": {}, "else": {}, "end": {}, "null": {},
+	}
+	sqlComparisons = map[string]struct{}{
+		"not": {}, "in": {}, "like": {}, "ilike": {},
+	}
+)
+
+// NewRedactor returns a Redactor, without options it doesn't change statements.
+func NewRedactor(opts ...RedactOption) *Redactor {
+	r := &Redactor{
+		columns: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// RedactColumns masks the values compared with or inserted into columns, names are case-insensitive.
+func RedactColumns(columns ...string) RedactOption {
+	return func(r *Redactor) {
+		for _, column := range columns {
+			r.columns[strings.ToLower(column)] = struct{}{}
+		}
+	}
+}
+
+// RedactPatterns masks the text of statements matching patterns, e.g. emails or card numbers.
+func RedactPatterns(patterns ...*regexp.Regexp) RedactOption {
+	return func(r *Redactor) {
+		r.patterns = append(r.patterns, patterns...)
+	}
+}
+
+// RedactParameterized keeps the placeholders of statements and appends their vars as a comment,
+// e.g. SELECT * FROM `users` WHERE `name` = ? AND `password` = ? -- args: ["nan", "xxxxx"].
+func RedactParameterized() RedactOption {
+	return func(r *Redactor) {
+		r.parameterized = true
+	}
+}
+
+// RedactMaxLength truncates statements longer than n bytes, e.g. big IN lists and batch inserts.
+func RedactMaxLength(n int) RedactOption {
+	return func(r *Redactor) {
+		if n > 0 {
+			r.maxLength = n
+		}
+	}
+}
+
+// ParamsFilter masks the vars bound to the redacted columns, in parameterized mode the vars are
+// appended to sql and none are returned, so that Dialector.Explain keeps the placeholders.
+func (r *Redactor) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if len(r.columns) > 0 && len(params) > 0 {
+		masked := make([]interface{}, len(params))
+		copy(masked, params)
+		for i, column := range bindColumns(sql, len(params)) {
+			if _, ok := r.columns[column]; ok {
+				masked[i] = RedactedValue
+			}
+		}
+		params = masked
+	}
+	if !r.parameterized {
+		return sql, params
+	}
+	if len(params) == 0 {
+		return sql, nil
+	}
+
+	var b strings.Builder
+	b.WriteString(sql)
+	b.WriteString(" -- args: [")
+	for i, param := range params {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if str, ok := param.(string); ok {
+			b.WriteString(strconv.Quote(str))
+		} else {
+			fmt.Fprintf(&b, "%v", param)
+		}
+	}
+	b.WriteString("]")
+	return b.String(), nil
+}
+
+// RedactSql masks the text matching the patterns, then truncates sql to the max length.
+func (r *Redactor) RedactSql(sql string) string {
+	for _, pattern := range r.patterns {
+		sql = pattern.ReplaceAllString(sql, RedactedValue)
+	}
+	if r.maxLength <= 0 || len(sql) <= r.maxLength {
+		return sql
+	}
+
+	end := r.maxLength
+	for end > 0 && !utf8.RuneStart(sql[end]) {
+		end--
+	}
+	return fmt.Sprintf("%s... (%d bytes truncated)", sql[:end], len(sql)-end)
+}
+
+// bindColumns returns the lower case column each of the n vars of sql is bound to, or empty if unknown.
+// It is a best effort: a var is bound to the column it is compared with, e.g. `password` = ?
+// or `id` IN (?,?), or to its column in the column list of an INSERT.
+func bindColumns(sql string, n int) []string {
+	tokens := tokenizeSql(sql)
+	columns := make([]string, n)
+	insertColumns, valuesAt := insertColumnsOf(tokens)
+
+	var inserted int
+	for i, token := range tokens {
+		if token.kind != tokenPlaceholder || token.index < 0 || token.index >= n {
+			continue
+		}
+		if column := comparedColumn(tokens, i); column != "" {
+			columns[token.index] = column
+		} else if valuesAt >= 0 && i > valuesAt && len(insertColumns) > 0 {
+			columns[token.index] = insertColumns[inserted%len(insertColumns)]
+		}
+		if valuesAt >= 0 && i > valuesAt {
+			inserted++
+		}
+	}
+	return columns
+}
+
+// comparedColumn returns the column compared with the placeholder at i, skipping the other
+// placeholders of an IN list.
+func comparedColumn(tokens []sqlToken, i int) string {
+	j := i - 1
+	for j >= 0 && (tokens[j].kind == tokenPlaceholder || tokens[j].text == "(" || tokens[j].text == ",") {
+		j--
+	}
+
+	var compared bool
+	for j >= 0 {
+		if tokens[j].kind == tokenOperator {
+			compared = true
+		} else if _, ok := sqlComparisons[tokens[j].text]; ok && tokens[j].kind == tokenKeyword {
+			compared = true
+		} else {
+			break
+		}
+		j--
+	}
+	if !compared || j < 0 || tokens[j].kind != tokenIdent {
+		return ""
+	}
+	return tokens[j].text
+}
+
+// insertColumnsOf returns the column list of an INSERT and the index of its VALUES keyword,
+// the index is -1 if tokens isn't an INSERT.
+func insertColumnsOf(tokens []sqlToken) ([]string, int) {
+	if len(tokens) == 0 || (tokens[0].text != "insert" && tokens[0].text != "replace") {
+		return nil, -1
+	}
+
+	var (
+		columns []string
+		inList  bool
+	)
+	for i, token := range tokens {
+		switch {
+		case token.kind == tokenKeyword && token.text == "values":
+			return columns, i
+		case token.text == "(":
+			inList, columns = true, nil
+		case token.text == ")":
+			inList = false
+		case inList && token.kind == tokenIdent:
+			columns = append(columns, token.text)
+		}
+	}
+	return nil, -1
+}
+
+// tokenizeSql splits sql into tokens, quoted identifiers are unquoted and identifiers and keywords
+// are lower case. Placeholders are ? or $n, string literals and comments are skipped.
+func tokenizeSql(sql string) []sqlToken {
+	var (
+		tokens []sqlToken
+		next   int
+	)
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'':
+			i = skipQuoted(sql, i, '\'')
+			tokens = append(tokens, sqlToken{kind: tokenOther, text: "'"})
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(sql)
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(sql)
+			}
+		case c == '`' || c == '"' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end := skipQuoted(sql, i, closing)
+			text := strings.TrimSuffix(sql[i+1:end], string(closing))
+			tokens = append(tokens, sqlToken{kind: tokenIdent, text: strings.ToLower(text)})
+			i = end
+		case c == '?':
+			tokens = append(tokens, sqlToken{kind: tokenPlaceholder, text: "?", index: next})
+			next++
+			i++
+		case c == '$' && i+1 < len(sql) && isDigit(sql[i+1]):
+			end := i + 1
+			for end < len(sql) && isDigit(sql[end]) {
+				end++
+			}
+			n, _ := strconv.Atoi(sql[i+1 : end])
+			tokens = append(tokens, sqlToken{kind: tokenPlaceholder, text: sql[i:end], index: n - 1})
+			i = end
+		case isWordByte(c):
+			end := i
+			for end < len(sql) && (isWordByte(sql[end]) || isDigit(sql[end]) || sql[end] == '$') {
+				end++
+			}
+			text := strings.ToLower(sql[i:end])
+			kind := tokenIdent
+			if _, ok := sqlKeywords[text]; ok {
+				kind = tokenKeyword
+			} else if isDigit(c) {
+				kind = tokenOther
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: text})
+			i = end
+		case strings.IndexByte("=<>!", c) >= 0:
+			end := i
+			for end < len(sql) && strings.IndexByte("=<>!", sql[end]) >= 0 {
+				end++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenOperator, text: sql[i:end]})
+			i = end
+		default:
+			tokens = append(tokens, sqlToken{kind: tokenOther, text: string(c)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// skipQuoted returns the index after the quoted text starting at i, a doubled quote is escaped.
+func skipQuoted(sql string, i int, quote byte) int {
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case sql[j] == '\\' && quote == '\'':
+			j++
+		case sql[j] == quote:
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(sql)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || isDigit(c) || c >= utf8.RuneSelf
+}
+
+var _ SqlRedactor = (*Redactor)(nil)
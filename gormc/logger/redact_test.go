@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func TestRedactor_ParamsFilter(t *testing.T) {
+	r := NewRedactor(RedactColumns("Password", "token"))
+	cases := []struct {
+		name string
+		sql  string
+		vars []interface{}
+		want []interface{}
+	}{
+		{
+			name: "where",
+			sql:  "SELECT * FROM `users` WHERE `users`.`name` = ? AND `users`.`password` = ?",
+			vars: []interface{}{"nan", "secret"},
+			want: []interface{}{"nan", RedactedValue},
+		},
+		{
+			name: "in",
+			sql:  "SELECT * FROM users WHERE token NOT IN (?,?) AND id > ?",
+			vars: []interface{}{"a", "b", 1},
+			want: []interface{}{RedactedValue, RedactedValue, 1},
+		},
+		{
+			name: "update",
+			sql:  `UPDATE "users" SET "password"=$2,"name"=$1 WHERE "id" = $3`,
+			vars: []interface{}{"nan", "secret", 1},
+			want: []interface{}{"nan", RedactedValue, 1},
+		},
+		{
+			name: "insert",
+			sql:  "INSERT INTO `users` (`name`,`password`) VALUES (?,?),(?,?) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`)",
+			vars: []interface{}{"a", "1", "b", "2"},
+			want: []interface{}{"a", RedactedValue, "b", RedactedValue},
+		},
+		{
+			name: "literal",
+			sql:  "SELECT * FROM users WHERE note = 'password = ?' AND name = ?",
+			vars: []interface{}{"nan"},
+			want: []interface{}{"nan"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sql, vars := r.ParamsFilter(context.Background(), c.sql, c.vars...)
+			if sql != c.sql || len(vars) != len(c.want) {
+				t.Fatalf("expected sql unchanged, got %s %v", sql, vars)
+			}
+			for i := range vars {
+				if vars[i] != c.want[i] {
+					t.Fatalf("expected %v, got %v", c.want, vars)
+				}
+			}
+		})
+	}
+
+	r = NewRedactor(RedactColumns("password"), RedactParameterized())
+	sql, vars := r.ParamsFilter(context.Background(), "SELECT * FROM users WHERE name = ? AND password = ?", "nan", "secret")
+	if sql != `SELECT * FROM users WHERE name = ? AND password = ? -- args: ["nan", "xxxxx"]` || vars != nil {
+		t.Fatalf("expected placeholders with masked vars, got %s %v", sql, vars)
+	}
+}
+
+func TestRedactor_RedactSql(t *testing.T) {
+	r := NewRedactor(RedactPatterns(regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.]+`)), RedactMaxLength(41))
+	if sql := r.RedactSql("SELECT * FROM users WHERE email = 'a@b.com'"); sql != "SELECT * FROM users WHERE email = 'xxxxx'" {
+		t.Fatalf("expected the email to be masked, got %s", sql)
+	}
+	sql := r.RedactSql("SELECT * FROM users WHERE id IN (1,2,3,4,5,6,7,8,9)")
+	if sql != "SELECT * FROM users WHERE id IN (1,2,3,4,... (10 bytes truncated)" {
+		t.Fatalf("expected a truncated sql, got %s", sql)
+	}
+	if sql = NewRedactor(RedactMaxLength(2)).RedactSql("中文"); sql != "... (6 bytes truncated)" {
+		t.Fatalf("expected to truncate at a rune boundary, got %s", sql)
+	}
+}
+
+func TestZeroLog_Redactor(t *testing.T) {
+	var buf strings.Builder
+	logx.SetWriter(logx.NewWriter(&buf))
+	defer logx.Reset()
+
+	log := NewZeroLog(gormLogger.Config{LogLevel: gormLogger.Info},
+		WithRedactor(NewRedactor(RedactColumns("password"), RedactMaxLength(30))))
+	sql, vars := log.(SqlRedactor).ParamsFilter(context.Background(), "UPDATE users SET password = ?", "secret")
+	if vars[0] != RedactedValue {
+		t.Fatalf("expected the password to be masked, got %v", vars)
+	}
+	log.Trace(context.Background(), time.Now(), func() (string, int64) {
+		return sql + " WHERE id IN (1,2,3,4,5,6,7,8,9)", 1
+	}, nil)
+	if !strings.Contains(buf.String(), "bytes truncated") {
+		t.Fatalf("expected a truncated sql, got %s", buf.String())
+	}
+}
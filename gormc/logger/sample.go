@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/utils"
+)
+
+const maxSampleFingerprints = 10000
+
+type (
+	// SampleOption customizes the sampling of WithSampling.
+	SampleOption func(s *sampler)
+
+	// sampler decides which statements logged at Info level are written.
+	sampler struct {
+		rate     float64
+		hasRate  bool
+		first    int64
+		interval time.Duration
+
+		mu       sync.Mutex
+		counters map[string]*sampleCounter
+		swept    time.Time
+	}
+
+	sampleCounter struct {
+		start   time.Time
+		logged  int64
+		skipped int64
+	}
+
+	// sampleReport is the count of the skipped statements of a fingerprint.
+	sampleReport struct {
+		fingerprint string
+		skipped     int64
+	}
+)
+
+// SampleRate logs a ratio of the statements, between 0 and 1.
+// With SampleFirst, the ratio applies to the statements after the first n of their fingerprint,
+// which are skipped without it.
+func SampleRate(rate float64) SampleOption {
+	return func(s *sampler) {
+		s.rate = min(max(rate, 0), 1)
+		s.hasRate = true
+	}
+}
+
+// SampleFirst logs the first n statements of each fingerprint per interval, see utils.SqlFingerprint.
+// The count of the skipped ones is logged once their interval has passed, with the next statement of any fingerprint.
+func SampleFirst(n int, interval time.Duration) SampleOption {
+	return func(s *sampler) {
+		if n > 0 && interval > 0 {
+			s.first = int64(n)
+			s.interval = interval
+		}
+	}
+}
+
+func newSampler(opts ...SampleOption) *sampler {
+	s := &sampler{
+		counters: make(map[string]*sampleCounter),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// byRate reports whether a statement is logged when sampling by rate only.
+func (s *sampler) byRate() bool {
+	return !s.hasRate || s.rate >= 1 || rand.Float64() < s.rate
+}
+
+// byFingerprint reports whether the statement of sql is logged, and the counts of the skipped statements
+// of the fingerprints whose interval has passed. Expired counters are swept at most once per interval,
+// so fingerprints that stop occurring still report their counts.
+func (s *sampler) byFingerprint(sql string, now time.Time) (logged bool, reports []sampleReport) {
+	fingerprint := utils.SqlFingerprint(sql)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.swept) >= s.interval {
+		reports = s.flush(reports, now, false)
+		s.swept = now
+	}
+	c, ok := s.counters[fingerprint]
+	if ok && now.Sub(c.start) >= s.interval {
+		reports = s.flush(reports, now, false)
+		ok = false
+	}
+	if !ok {
+		if len(s.counters) >= maxSampleFingerprints {
+			// too many shapes, e.g. of statements built with literals, report them and start over.
+			reports = s.flush(reports, now, true)
+		}
+		c = &sampleCounter{start: now}
+		s.counters[fingerprint] = c
+	}
+
+	logged = c.logged < s.first || (s.hasRate && rand.Float64() < s.rate)
+	if logged {
+		c.logged++
+	} else {
+		c.skipped++
+	}
+	return logged, reports
+}
+
+// flush removes the expired counters, or all of them, and appends their skipped counts to reports.
+func (s *sampler) flush(reports []sampleReport, now time.Time, all bool) []sampleReport {
+	n := len(reports)
+	for fingerprint, c := range s.counters {
+		if !all && now.Sub(c.start) < s.interval {
+			continue
+		}
+		if c.skipped > 0 {
+			reports = append(reports, sampleReport{fingerprint: fingerprint, skipped: c.skipped})
+		}
+		delete(s.counters, fingerprint)
+	}
+	slices.SortFunc(reports[n:], func(a, b sampleReport) int {
+		return strings.Compare(a.fingerprint, b.fingerprint)
+	})
+	return reports
+}
@@ -0,0 +1,121 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func TestSampler_ByFingerprint(t *testing.T) {
+	s := newSampler(SampleFirst(2, time.Minute))
+	now := time.Now()
+	sample := func(sql string, at time.Time) (bool, int64) {
+		logged, reports := s.byFingerprint(sql, at)
+		var skipped int64
+		for _, report := range reports {
+			skipped += report.skipped
+		}
+		return logged, skipped
+	}
+
+	for i, want := range []bool{true, true, false, false} {
+		if logged, _ := sample("SELECT * FROM users WHERE id = "+strconv.Itoa(i), now); logged != want {
+			t.Fatalf("expected statement %d logged %v", i, want)
+		}
+	}
+	if logged, _ := sample("SELECT * FROM orders WHERE id = 1", now); !logged {
+		t.Fatal("expected another fingerprint to be logged")
+	}
+	if logged, skipped := sample("SELECT * FROM users WHERE id = 9", now.Add(time.Minute)); !logged || skipped != 2 {
+		t.Fatalf("expected the next interval to log the 2 skipped, got %v %d", logged, skipped)
+	}
+
+	s = newSampler(SampleFirst(1, time.Minute), SampleRate(1))
+	for i := 0; i < 3; i++ {
+		if logged, _ := sample("SELECT 1", now); !logged {
+			t.Fatal("expected the rate to apply after the first statements")
+		}
+	}
+}
+
+func TestSampler_Flush(t *testing.T) {
+	s := newSampler(SampleFirst(1, time.Minute))
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		s.byFingerprint("SELECT * FROM users WHERE id = 1", now)
+	}
+
+	// users stops occurring, its count is reported with the next statement after the interval.
+	_, reports := s.byFingerprint("SELECT * FROM orders WHERE id = 1", now.Add(time.Minute))
+	want := []sampleReport{{fingerprint: "select * from users where id = ?", skipped: 2}}
+	if !slices.Equal(reports, want) {
+		t.Fatalf("expected the count of the expired fingerprint, got %+v", reports)
+	}
+	if _, ok := s.counters[want[0].fingerprint]; ok {
+		t.Fatal("expected the expired counter to be removed")
+	}
+
+	// at the limit, the pending counts are reported before starting over.
+	s = newSampler(SampleFirst(1, time.Hour))
+	for i := range maxSampleFingerprints {
+		s.counters[strconv.Itoa(i)] = &sampleCounter{start: now, skipped: 1}
+	}
+	_, reports = s.byFingerprint("SELECT 1", now)
+	if len(reports) != maxSampleFingerprints || len(s.counters) != 1 {
+		t.Fatalf("expected the pending counts to be reported, got %d reports and %d counters",
+			len(reports), len(s.counters))
+	}
+}
+
+func TestSampler_ByRate(t *testing.T) {
+	if !newSampler().byRate() || !newSampler(SampleRate(1)).byRate() {
+		t.Fatal("expected all statements to be logged")
+	}
+	if newSampler(SampleRate(0)).byRate() {
+		t.Fatal("expected no statement to be logged")
+	}
+}
+
+func TestZeroLog_Sampling(t *testing.T) {
+	var buf strings.Builder
+	logx.SetWriter(logx.NewWriter(&buf))
+	defer logx.Reset()
+
+	log := NewZeroLog(gormLogger.Config{LogLevel: gormLogger.Info, SlowThreshold: 10 * time.Millisecond},
+		WithSampling(SampleRate(0)))
+	var calls int
+	traceFc := func() (sql string, rowsAffected int64) {
+		calls++
+		return "select * from test", 1
+	}
+
+	log.Trace(context.Background(), time.Now(), traceFc, nil)
+	if buf.Len() != 0 || calls != 0 {
+		t.Fatalf("expected the statement to be skipped without explaining it, got %s", buf.String())
+	}
+	log.Trace(context.Background(), time.Now(), traceFc, errors.New("boom"))
+	log.Trace(context.Background(), time.Now().Add(-20*time.Millisecond), traceFc, nil)
+	log.Trace(WithLevel(context.Background(), gormLogger.Info), time.Now(), traceFc, nil)
+	if n := strings.Count(buf.String(), "select * from test"); n != 3 {
+		t.Fatalf("expected errors, slow and raised statements to be logged, got %d: %s", n, buf.String())
+	}
+
+	buf.Reset()
+	log = NewZeroLog(gormLogger.Config{LogLevel: gormLogger.Info}, WithStructured(),
+		WithSampling(SampleFirst(1, 10*time.Millisecond)))
+	log.Trace(context.Background(), time.Now(), traceFc, nil)
+	log.Trace(context.Background(), time.Now(), traceFc, nil)
+	time.Sleep(10 * time.Millisecond)
+	log.Trace(context.Background(), time.Now(), traceFc, nil)
+	logs := buf.String()
+	if strings.Count(logs, `"content":"sql"`) != 2 || !strings.Contains(logs, `"skipped":1`) {
+		t.Fatalf("expected the first statement per interval and the count of the skipped, got %s", logs)
+	}
+}
@@ -0,0 +1,33 @@
+package outbox
+
+import "time"
+
+// DefaultTableName is the table used by Message unless overridden.
+const DefaultTableName = "outbox_message"
+
+const (
+	// StatusPending marks a message waiting to be delivered.
+	StatusPending int8 = iota
+	// StatusSent marks a message that has been delivered.
+	StatusSent
+	// StatusFailed marks a message that exhausted its delivery attempts.
+	StatusFailed
+)
+
+// Message is the gorm model of the outbox table.
+type Message struct {
+	Id            uint64     `gorm:"column:id;primaryKey;autoIncrement"`
+	Topic         string     `gorm:"column:topic;type:varchar(255);not null"`
+	Payload       []byte     `gorm:"column:payload"`
+	Status        int8       `gorm:"column:status;not null;default:0;index:idx_outbox_status_next,priority:1"`
+	Attempts      int        `gorm:"column:attempts;not null;default:0"`
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;not null;index:idx_outbox_status_next,priority:2"`
+	LastError     string     `gorm:"column:last_error;type:varchar(1024)"`
+	SentAt        *time.Time `gorm:"column:sent_at"`
+	CreatedAt     time.Time  `gorm:"column:created_at"`
+	UpdatedAt     time.Time  `gorm:"column:updated_at"`
+}
+
+func (Message) TableName() string {
+	return DefaultTableName
+}
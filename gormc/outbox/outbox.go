@@ -0,0 +1,32 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrNilTx is returned when Enqueue is called without a transaction.
+var ErrNilTx = errors.New("outbox: enqueue requires a transaction")
+
+// Enqueue writes a message for topic inside tx, so it is committed or rolled back
+// together with the business rows. tx is usually the db passed to TransactCtx.
+func Enqueue(ctx context.Context, tx *gorm.DB, topic string, payload []byte) error {
+	if tx == nil {
+		return ErrNilTx
+	}
+	msg := Message{
+		Topic:         topic,
+		Payload:       payload,
+		Status:        StatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	return tx.WithContext(ctx).Create(&msg).Error
+}
+
+// AutoMigrate creates or updates the outbox table.
+func AutoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Message{})
+}
@@ -0,0 +1,213 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type txConn struct {
+	db *gorm.DB
+}
+
+func (c txConn) TransactCtx(ctx context.Context, fn func(db *gorm.DB) error, opts ...*sql.TxOptions) error {
+	return c.db.WithContext(ctx).Transaction(fn, opts...)
+}
+
+type order struct {
+	Id   uint64 `gorm:"column:id;primaryKey"`
+	Name string `gorm:"column:name"`
+}
+
+func createTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "outbox.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.AutoMigrate(&order{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err = AutoMigrate(db); err != nil {
+		t.Fatalf("migrate outbox: %v", err)
+	}
+	return db
+}
+
+func TestEnqueueWithinTransaction(t *testing.T) {
+	db := createTestDB(t)
+	conn := txConn{db: db}
+	ctx := context.Background()
+
+	err := conn.TransactCtx(ctx, func(tx *gorm.DB) error {
+		if err := tx.Create(&order{Id: 1, Name: "committed"}).Error; err != nil {
+			return err
+		}
+		return Enqueue(ctx, tx, "order.created", []byte(`{"id":1}`))
+	})
+	if err != nil {
+		t.Fatalf("transact: %v", err)
+	}
+
+	rollback := errors.New("rollback")
+	err = conn.TransactCtx(ctx, func(tx *gorm.DB) error {
+		if err := Enqueue(ctx, tx, "order.created", []byte(`{"id":2}`)); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatalf("expected rollback error, got %v", err)
+	}
+
+	var msgs []Message
+	if err = db.Find(&msgs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || string(msgs[0].Payload) != `{"id":1}` {
+		t.Fatalf("expected only the committed message, got %+v", msgs)
+	}
+
+	if err = Enqueue(ctx, nil, "t", nil); !errors.Is(err, ErrNilTx) {
+		t.Fatalf("expected ErrNilTx, got %v", err)
+	}
+}
+
+func TestRelayDelivers(t *testing.T) {
+	db := createTestDB(t)
+	conn := txConn{db: db}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := Enqueue(ctx, db, "topic", []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pub := NewMemoryPublisher(nil)
+	relay := NewRelay(conn, pub, WithBatchSize(2))
+	n, err := relay.RelayOnce(ctx)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 handled, got %d, %v", n, err)
+	}
+	n, err = relay.RelayOnce(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 handled, got %d, %v", n, err)
+	}
+	n, err = relay.RelayOnce(ctx)
+	if err != nil || n != 0 {
+		t.Fatalf("expected nothing left, got %d, %v", n, err)
+	}
+
+	published := pub.Messages()
+	if len(published) != 3 {
+		t.Fatalf("expected 3 published, got %d", len(published))
+	}
+	var sent int64
+	db.Model(&Message{}).Where("status = ? AND sent_at IS NOT NULL", StatusSent).Count(&sent)
+	if sent != 3 {
+		t.Fatalf("expected 3 sent rows, got %d", sent)
+	}
+}
+
+func TestRelayRetryAndFail(t *testing.T) {
+	db := createTestDB(t)
+	conn := txConn{db: db}
+	ctx := context.Background()
+
+	if err := Enqueue(ctx, db, "topic", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	pub := NewMemoryPublisher(func(msg *Message) error {
+		return errors.New("broker down")
+	})
+	relay := NewRelay(conn, pub, WithMaxAttempts(2), WithBackoff(time.Hour, 2*time.Hour))
+
+	if _, err := relay.RelayOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var msg Message
+	db.First(&msg)
+	if msg.Status != StatusPending || msg.Attempts != 1 || msg.LastError != "broker down" {
+		t.Fatalf("unexpected message after first failure: %+v", msg)
+	}
+	if !msg.NextAttemptAt.After(time.Now().Add(30 * time.Minute)) {
+		t.Fatalf("expected backoff, next attempt at %v", msg.NextAttemptAt)
+	}
+
+	// not due yet
+	n, err := relay.RelayOnce(ctx)
+	if err != nil || n != 0 {
+		t.Fatalf("expected no due message, got %d, %v", n, err)
+	}
+
+	db.Model(&msg).Update("next_attempt_at", time.Now().Add(-time.Second))
+	if _, err = relay.RelayOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	db.First(&msg)
+	if msg.Status != StatusFailed || msg.Attempts != 2 {
+		t.Fatalf("expected failed message, got %+v", msg)
+	}
+}
+
+func TestTruncateError(t *testing.T) {
+	msg := strings.Repeat("a", maxLastErrorLen-1) + "错误"
+	got := truncateError(msg)
+	if !utf8.ValidString(got) || got != strings.Repeat("a", maxLastErrorLen-1) {
+		t.Fatalf("expected truncation on a rune boundary, got %q", got[len(got)-4:])
+	}
+	if got = truncateError("broker down"); got != "broker down" {
+		t.Fatalf("expected a short error to be kept, got %q", got)
+	}
+}
+
+func TestRelayBackoff(t *testing.T) {
+	relay := NewRelay(nil, nil, WithBackoff(time.Second, 5*time.Second))
+	cases := map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 5 * time.Second,
+		9: 5 * time.Second,
+	}
+	for attempts, want := range cases {
+		if got := relay.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestRelayStartStop(t *testing.T) {
+	db := createTestDB(t)
+	if err := Enqueue(context.Background(), db, "topic", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	pub := NewMemoryPublisher(nil)
+	relay := NewRelay(txConn{db: db}, pub, WithPollInterval(10*time.Millisecond))
+	done := make(chan struct{})
+	go func() {
+		relay.Start()
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pub.Messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	relay.Stop()
+	<-done
+
+	if len(pub.Messages()) != 1 {
+		t.Fatalf("expected 1 published message, got %d", len(pub.Messages()))
+	}
+}
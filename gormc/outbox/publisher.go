@@ -0,0 +1,57 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+)
+
+// Publisher delivers outbox messages to a broker.
+// Publish may be called more than once for the same message, consumers should dedupe by Message.Id.
+type Publisher interface {
+	Publish(ctx context.Context, msg *Message) error
+}
+
+// PublisherFunc is an adapter to allow the use of ordinary functions as Publisher.
+type PublisherFunc func(ctx context.Context, msg *Message) error
+
+// Publish calls f(ctx, msg).
+func (f PublisherFunc) Publish(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// MemoryPublisher is an in-memory Publisher, mostly used in tests.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []Message
+	failFn   func(msg *Message) error
+}
+
+// NewMemoryPublisher returns a MemoryPublisher.
+// If failFn is not nil, its non-nil results are returned from Publish and the message is not recorded.
+func NewMemoryPublisher(failFn func(msg *Message) error) *MemoryPublisher {
+	return &MemoryPublisher{failFn: failFn}
+}
+
+// Publish records msg.
+func (p *MemoryPublisher) Publish(_ context.Context, msg *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.failFn != nil {
+		if err := p.failFn(msg); err != nil {
+			return err
+		}
+	}
+	p.messages = append(p.messages, *msg)
+	return nil
+}
+
+// Messages returns a copy of the published messages.
+func (p *MemoryPublisher) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	res := make([]Message, len(p.messages))
+	copy(res, p.messages)
+	return res
+}
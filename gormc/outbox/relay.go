@@ -0,0 +1,244 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultBatchSize    = 100
+	defaultPollInterval = time.Second
+	defaultMaxAttempts  = 10
+	defaultBaseBackoff  = time.Second
+	defaultMaxBackoff   = 5 * time.Minute
+	maxLastErrorLen     = 1024
+)
+
+type (
+	// Transactor runs fn in a transaction, gormc.CachedConn satisfies it.
+	Transactor interface {
+		TransactCtx(ctx context.Context, fn func(db *gorm.DB) error, opts ...*sql.TxOptions) error
+	}
+
+	// RelayOption customizes a Relay.
+	RelayOption func(r *Relay)
+
+	// Relay polls pending outbox messages and delivers them through a Publisher.
+	Relay struct {
+		conn         Transactor
+		publisher    Publisher
+		batchSize    int
+		pollInterval time.Duration
+		maxAttempts  int
+		baseBackoff  time.Duration
+		maxBackoff   time.Duration
+		skipLocked   *bool
+
+		ctx      context.Context
+		cancel   context.CancelFunc
+		stopOnce sync.Once
+	}
+)
+
+// NewRelay returns a Relay that delivers messages stored through conn.
+func NewRelay(conn Transactor, publisher Publisher, opts ...RelayOption) *Relay {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Relay{
+		conn:         conn,
+		publisher:    publisher,
+		batchSize:    defaultBatchSize,
+		pollInterval: defaultPollInterval,
+		maxAttempts:  defaultMaxAttempts,
+		baseBackoff:  defaultBaseBackoff,
+		maxBackoff:   defaultMaxBackoff,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithBatchSize sets how many messages are fetched per poll.
+func WithBatchSize(size int) RelayOption {
+	return func(r *Relay) {
+		if size > 0 {
+			r.batchSize = size
+		}
+	}
+}
+
+// WithPollInterval sets the interval between two polls.
+func WithPollInterval(interval time.Duration) RelayOption {
+	return func(r *Relay) {
+		if interval > 0 {
+			r.pollInterval = interval
+		}
+	}
+}
+
+// WithMaxAttempts sets how many times a message is tried before it is marked as failed.
+func WithMaxAttempts(attempts int) RelayOption {
+	return func(r *Relay) {
+		if attempts > 0 {
+			r.maxAttempts = attempts
+		}
+	}
+}
+
+// WithBackoff sets the exponential retry backoff, doubling from base up to max.
+func WithBackoff(base, max time.Duration) RelayOption {
+	return func(r *Relay) {
+		if base > 0 {
+			r.baseBackoff = base
+		}
+		if max >= base {
+			r.maxBackoff = max
+		}
+	}
+}
+
+// WithSkipLocked forces using or not using FOR UPDATE SKIP LOCKED,
+// by default it is used on mysql and postgres only.
+// Disable it for MySQL versions before 8.0.
+func WithSkipLocked(enabled bool) RelayOption {
+	return func(r *Relay) {
+		r.skipLocked = &enabled
+	}
+}
+
+// Start polls and delivers messages until Stop is called.
+func (r *Relay) Start() {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.drain()
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the relay.
+func (r *Relay) Stop() {
+	r.stopOnce.Do(r.cancel)
+}
+
+func (r *Relay) drain() {
+	for {
+		n, err := r.RelayOnce(r.ctx)
+		if err != nil {
+			if r.ctx.Err() == nil {
+				logx.WithContext(r.ctx).Errorf("outbox relay failed: %v", err)
+			}
+			return
+		}
+		if n < r.batchSize {
+			return
+		}
+	}
+}
+
+// RelayOnce delivers one batch of due messages and returns how many were handled.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	var handled int
+	err := r.conn.TransactCtx(ctx, func(tx *gorm.DB) error {
+		var msgs []Message
+		now := time.Now()
+		db := tx.Where("status = ? AND next_attempt_at <= ?", StatusPending, now).
+			Order("id").Limit(r.batchSize)
+		if r.useSkipLocked(tx) {
+			db = db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := db.Find(&msgs).Error; err != nil {
+			return err
+		}
+
+		for i := range msgs {
+			if err := r.deliver(ctx, tx, &msgs[i]); err != nil {
+				return err
+			}
+		}
+		handled = len(msgs)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return handled, nil
+}
+
+func (r *Relay) deliver(ctx context.Context, tx *gorm.DB, msg *Message) error {
+	now := time.Now()
+	pubErr := r.publisher.Publish(ctx, msg)
+	if pubErr == nil {
+		return tx.Model(msg).Updates(map[string]interface{}{
+			"status":     StatusSent,
+			"sent_at":    now,
+			"last_error": "",
+		}).Error
+	}
+
+	attempts := msg.Attempts + 1
+	status := StatusPending
+	if attempts >= r.maxAttempts {
+		status = StatusFailed
+		logx.WithContext(ctx).Errorf("outbox message %d on topic %s failed after %d attempts: %v",
+			msg.Id, msg.Topic, attempts, pubErr)
+	}
+	return tx.Model(msg).Updates(map[string]interface{}{
+		"status":          status,
+		"attempts":        attempts,
+		"next_attempt_at": now.Add(r.backoff(attempts)),
+		"last_error":      truncateError(pubErr.Error()),
+	}).Error
+}
+
+// truncateError truncates msg to maxLastErrorLen bytes on a rune boundary,
+// databases like postgres reject invalid utf-8.
+func truncateError(msg string) string {
+	if len(msg) <= maxLastErrorLen {
+		return msg
+	}
+
+	end := maxLastErrorLen
+	for end > 0 && !utf8.RuneStart(msg[end]) {
+		end--
+	}
+	return msg[:end]
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.baseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= r.maxBackoff {
+			return r.maxBackoff
+		}
+	}
+	return d
+}
+
+func (r *Relay) useSkipLocked(tx *gorm.DB) bool {
+	if r.skipLocked != nil {
+		return *r.skipLocked
+	}
+	switch tx.Dialector.Name() {
+	case "mysql", "postgres":
+		return true
+	default:
+		// sqlite and others have no row locks, run the plain select.
+		return false
+	}
+}
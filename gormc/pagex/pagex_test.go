@@ -110,6 +110,33 @@ func TestFindPageList(t *testing.T) {
 	fmt.Printf("Users: %+v, Count: %d\n", users, cnt)
 }
 
+func TestFindPageListWithConn(t *testing.T) {
+	db, err := createMockDB()
+	if err != nil {
+		t.Fatalf("Failed to create mock DB: %v", err)
+	}
+
+	users, cnt, err := FindPageList[TestUserModel](
+		context.Background(),
+		gormc.NewConnNoCache(db),
+		&ListReq{Page: 2, PageSize: 5},
+		OrderBy{OrderKey: "id", Sort: Desc()},
+		map[string]string{"id": "id"},
+		func(conn *gorm.DB) (*gorm.DB, *gorm.DB) {
+			return conn.Model(&TestUserModel{}), nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("TestFindPageListWithConn Err,%v", err.Error())
+	}
+	if cnt != 8 {
+		t.Errorf("Expected count 8, got %d", cnt)
+	}
+	if len(users) != 3 || users[0].Id != 3 {
+		t.Errorf("Expected 3 users starting from id 3, got %+v", users)
+	}
+}
+
 func TestFindPageListWithCount(t *testing.T) {
 	db, err := createMockDB()
 	if err != nil {
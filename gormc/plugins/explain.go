@@ -0,0 +1,360 @@
+package plugins
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/utils"
+	"github.com/zeromicro/go-zero/core/collection"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/threading"
+	"gorm.io/gorm"
+)
+
+const (
+	// SlowExplainPluginName is the name of SlowExplainPlugin in gorm.Config.Plugins.
+	SlowExplainPluginName = "gorm-zero-slow-explain-plugin"
+
+	callBackExplainBeforeName = "gorm-zero-explain:before"
+	callBackExplainAfterName  = "gorm-zero-explain:after"
+	explainStartKey           = "gorm-zero-explain-start"
+
+	defaultExplainInterval    = time.Minute
+	defaultExplainTimeout     = 5 * time.Second
+	defaultExplainConcurrency = 1
+	maxExplainFingerprints    = 10000
+)
+
+var (
+	// ErrExplainUnsupported is returned by Explain for the dialects other than mysql, postgres and sqlite.
+	ErrExplainUnsupported = errors.New("explain is not supported by the dialect")
+
+	sqliteIndexRegex = regexp.MustCompile(`USING (?:COVERING )?INDEX (\S+)|USING (?:INTEGER )?PRIMARY KEY`)
+)
+
+type (
+	// SlowExplainOption customizes a SlowExplainPlugin.
+	SlowExplainOption func(p *SlowExplainPlugin)
+
+	// SlowExplainPlugin explains the read statements slower than its threshold, asynchronously on
+	// another connection of the pool the statement ran on, e.g. a replica, and logs the plan summary
+	// with the fingerprint of the statement. A fingerprint is explained at most once per interval.
+	// Statements in a transaction are not explained, the rows they see may not be visible to other connections.
+	SlowExplainPlugin struct {
+		threshold time.Duration
+		interval  time.Duration
+		timeout   time.Duration
+		running   chan struct{}
+		explained *collection.Cache
+		db        *gorm.DB
+	}
+
+	// PlanSummary summarizes the plan of a statement, rows are estimated by the database.
+	PlanSummary struct {
+		FullScans    []string
+		RowsExamined int64
+		Indexes      []string
+	}
+
+	postgresPlan struct {
+		NodeType     string         `json:"Node Type"`
+		RelationName string         `json:"Relation Name"`
+		IndexName    string         `json:"Index Name"`
+		PlanRows     float64        `json:"Plan Rows"`
+		Plans        []postgresPlan `json:"Plans"`
+	}
+)
+
+// NewSlowExplainPlugin returns a SlowExplainPlugin explaining the statements slower than threshold,
+// use the SlowThreshold of the logger to log the plans next to the slow sql.
+func NewSlowExplainPlugin(threshold time.Duration, opts ...SlowExplainOption) *SlowExplainPlugin {
+	p := &SlowExplainPlugin{
+		threshold: threshold,
+		interval:  defaultExplainInterval,
+		timeout:   defaultExplainTimeout,
+		running:   make(chan struct{}, defaultExplainConcurrency),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// WithExplainInterval sets how often a fingerprint can be explained.
+func WithExplainInterval(interval time.Duration) SlowExplainOption {
+	return func(p *SlowExplainPlugin) {
+		if interval > 0 {
+			p.interval = interval
+		}
+	}
+}
+
+// WithExplainTimeout sets the timeout of an explain.
+func WithExplainTimeout(timeout time.Duration) SlowExplainOption {
+	return func(p *SlowExplainPlugin) {
+		if timeout > 0 {
+			p.timeout = timeout
+		}
+	}
+}
+
+// WithExplainConcurrency sets how many explains can run at once, slow statements are not explained
+// while all of them are running.
+func WithExplainConcurrency(n int) SlowExplainOption {
+	return func(p *SlowExplainPlugin) {
+		if n > 0 {
+			p.running = make(chan struct{}, n)
+		}
+	}
+}
+
+func (p *SlowExplainPlugin) Name() string {
+	return SlowExplainPluginName
+}
+
+func (p *SlowExplainPlugin) Initialize(db *gorm.DB) error {
+	explained, err := collection.NewCache(p.interval, collection.WithLimit(maxExplainFingerprints))
+	if err != nil {
+		return err
+	}
+	p.explained = explained
+	p.db = db
+
+	cb := db.Callback()
+	return errors.Join(
+		cb.Query().Before("gorm:query").Register(callBackExplainBeforeName, p.before),
+		cb.Query().After("gorm:query").Register(callBackExplainAfterName, p.after),
+		cb.Row().Before("gorm:row").Register(callBackExplainBeforeName, p.before),
+		cb.Row().After("gorm:row").Register(callBackExplainAfterName, p.after),
+		cb.Raw().Before("gorm:raw").Register(callBackExplainBeforeName, p.before),
+		cb.Raw().After("gorm:raw").Register(callBackExplainAfterName, p.after),
+	)
+}
+
+// Explain explains the statement sql with vars on another connection of the primary pool.
+func (p *SlowExplainPlugin) Explain(ctx context.Context, dialect, sql string, vars ...interface{}) (PlanSummary, error) {
+	sqldb, err := p.db.DB()
+	if err != nil {
+		return PlanSummary{}, err
+	}
+	return p.explain(ctx, sqldb, dialect, sql, vars...)
+}
+
+func (p *SlowExplainPlugin) explain(ctx context.Context, conn gorm.ConnPool, dialect, sql string,
+	vars ...interface{}) (PlanSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	switch dialect {
+	case "mysql":
+		rows, err := conn.QueryContext(ctx, "EXPLAIN "+sql, vars...)
+		if err != nil {
+			return PlanSummary{}, err
+		}
+		return summarizeMysqlPlan(rows)
+	case "postgres":
+		var plan []byte
+		if err := conn.QueryRowContext(ctx, "EXPLAIN (FORMAT JSON) "+sql, vars...).Scan(&plan); err != nil {
+			return PlanSummary{}, err
+		}
+		return summarizePostgresPlan(plan)
+	case "sqlite":
+		rows, err := conn.QueryContext(ctx, "EXPLAIN QUERY PLAN "+sql, vars...)
+		if err != nil {
+			return PlanSummary{}, err
+		}
+		return summarizeSqlitePlan(rows)
+	default:
+		return PlanSummary{}, ErrExplainUnsupported
+	}
+}
+
+func (p *SlowExplainPlugin) before(db *gorm.DB) {
+	db.InstanceSet(explainStartKey, time.Now())
+}
+
+func (p *SlowExplainPlugin) after(db *gorm.DB) {
+	start, ok := db.InstanceGet(explainStartKey)
+	if !ok || db.DryRun || p.threshold <= 0 {
+		return
+	}
+	elapsed := time.Since(start.(time.Time))
+	if elapsed < p.threshold || (db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound)) {
+		return
+	}
+	sql, dialect := db.Statement.SQL.String(), db.Dialector.Name()
+	if utils.SqlOperation(sql) != "select" || !explainable(dialect) {
+		return
+	}
+	conn, ok := explainConn(db.Statement.ConnPool)
+	if !ok {
+		return
+	}
+
+	fingerprint := utils.SqlFingerprint(sql)
+	if _, ok = p.explained.Get(fingerprint); ok {
+		return
+	}
+	select {
+	case p.running <- struct{}{}:
+	default:
+		return
+	}
+	p.explained.Set(fingerprint, struct{}{})
+
+	vars := append([]interface{}(nil), db.Statement.Vars...)
+	ctx := context.WithoutCancel(db.Statement.Context)
+	threading.GoSafeCtx(ctx, func() {
+		defer func() { <-p.running }()
+
+		summary, err := p.explain(ctx, conn, dialect, sql, vars...)
+		if err != nil {
+			logx.WithContext(ctx).Errorf("explain slow sql %q failed: %v", fingerprint, err)
+			return
+		}
+		logx.WithContext(ctx).WithDuration(elapsed).Sloww("slow sql plan",
+			logx.Field("fingerprint", fingerprint),
+			logx.Field("full_scans", summary.FullScans),
+			logx.Field("rows_examined", summary.RowsExamined),
+			logx.Field("indexes", summary.Indexes),
+		)
+	})
+}
+
+// explainConn returns the pool of conn, the pool a statement ran on, to explain the statement on.
+// A transaction or a reserved connection has no other connections to explain on.
+func explainConn(conn gorm.ConnPool) (gorm.ConnPool, bool) {
+	switch conn.(type) {
+	case gorm.TxCommitter, *sql.Conn:
+		return nil, false
+	}
+	// unwrap prepared statement pools, so the explains aren't prepared and cached.
+	if connector, ok := conn.(gorm.GetDBConnector); ok {
+		if sqldb, err := connector.GetDBConn(); err == nil && sqldb != nil {
+			return sqldb, true
+		}
+	}
+	return conn, conn != nil
+}
+
+func explainable(dialect string) bool {
+	return dialect == "mysql" || dialect == "postgres" || dialect == "sqlite"
+}
+
+// summarizeMysqlPlan summarizes the rows of EXPLAIN, a full scan has the access type ALL.
+func summarizeMysqlPlan(rows *sql.Rows) (PlanSummary, error) {
+	var summary PlanSummary
+	plan, err := scanPlanRows(rows)
+	if err != nil {
+		return summary, err
+	}
+	for _, row := range plan {
+		if row["type"] == "ALL" {
+			summary.FullScans = append(summary.FullScans, row["table"])
+		}
+		if len(row["key"]) > 0 {
+			summary.Indexes = append(summary.Indexes, row["key"])
+		}
+		n, _ := strconv.ParseInt(row["rows"], 10, 64)
+		summary.RowsExamined += n
+	}
+	return summary, nil
+}
+
+// summarizePostgresPlan summarizes the plan of EXPLAIN (FORMAT JSON), a full scan is a Seq Scan.
+func summarizePostgresPlan(content []byte) (PlanSummary, error) {
+	var (
+		summary PlanSummary
+		plans   []struct {
+			Plan postgresPlan `json:"Plan"`
+		}
+	)
+	if err := json.Unmarshal(content, &plans); err != nil {
+		return summary, err
+	}
+
+	var walk func(plan postgresPlan)
+	walk = func(plan postgresPlan) {
+		if plan.NodeType == "Seq Scan" {
+			summary.FullScans = append(summary.FullScans, plan.RelationName)
+		}
+		if len(plan.IndexName) > 0 {
+			summary.Indexes = append(summary.Indexes, plan.IndexName)
+		}
+		if len(plan.RelationName) > 0 {
+			summary.RowsExamined += int64(plan.PlanRows)
+		}
+		for _, child := range plan.Plans {
+			walk(child)
+		}
+	}
+	for _, plan := range plans {
+		walk(plan.Plan)
+	}
+	return summary, nil
+}
+
+// summarizeSqlitePlan summarizes the rows of EXPLAIN QUERY PLAN, sqlite doesn't estimate rows.
+func summarizeSqlitePlan(rows *sql.Rows) (PlanSummary, error) {
+	var summary PlanSummary
+	plan, err := scanPlanRows(rows)
+	if err != nil {
+		return summary, err
+	}
+	for _, row := range plan {
+		fields := strings.Fields(row["detail"])
+		if len(fields) < 2 || (fields[0] != "SCAN" && fields[0] != "SEARCH") {
+			continue
+		}
+		table := fields[1]
+		if table == "TABLE" && len(fields) > 2 {
+			table = fields[2]
+		}
+
+		match := sqliteIndexRegex.FindStringSubmatch(row["detail"])
+		switch {
+		case match == nil && fields[0] == "SCAN":
+			summary.FullScans = append(summary.FullScans, table)
+		case match != nil && len(match[1]) > 0:
+			summary.Indexes = append(summary.Indexes, match[1])
+		case match != nil:
+			summary.Indexes = append(summary.Indexes, "PRIMARY")
+		}
+	}
+	return summary, nil
+}
+
+// scanPlanRows returns rows as maps of lower case column names to values.
+func scanPlanRows(rows *sql.Rows) ([]map[string]string, error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var plan []map[string]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			row[strings.ToLower(column)] = values[i].String
+		}
+		plan = append(plan, row)
+	}
+	return plan, rows.Err()
+}
+
+var _ gorm.Plugin = (*SlowExplainPlugin)(nil)
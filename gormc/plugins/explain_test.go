@@ -0,0 +1,160 @@
+package plugins
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+type explainUser struct {
+	Id   uint64 `gorm:"column:id;primaryKey"`
+	Name string `gorm:"column:name;index:idx_name"`
+	Age  int    `gorm:"column:age"`
+}
+
+type syncWriter struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *syncWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestSlowExplainPlugin(t *testing.T) {
+	w := &syncWriter{}
+	logx.SetWriter(logx.NewWriter(w))
+	defer logx.Reset()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "explain.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&explainUser{}); err != nil {
+		t.Fatal(err)
+	}
+	p := NewSlowExplainPlugin(time.Nanosecond, WithExplainInterval(time.Hour))
+	if err = db.Use(p); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	summary, err := p.Explain(ctx, "sqlite", "SELECT * FROM explain_users WHERE name = ?", "nan")
+	if err != nil || len(summary.FullScans) != 0 || len(summary.Indexes) != 1 || summary.Indexes[0] != "idx_name" {
+		t.Fatalf("expected the index to be used, got %+v %v", summary, err)
+	}
+	if _, err = p.Explain(ctx, "sqlserver", "SELECT 1"); err != ErrExplainUnsupported {
+		t.Fatalf("expected ErrExplainUnsupported, got %v", err)
+	}
+
+	var users []explainUser
+	db.Where("age > ?", 1).Find(&users)
+	db.Where("age > ?", 2).Find(&users)
+	db.Create(&explainUser{Id: 1, Name: "nan"})
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !strings.Contains(w.String(), "slow sql plan") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the plan to be logged, got %s", w.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	logs := w.String()
+	if strings.Count(logs, "slow sql plan") != 1 {
+		t.Fatalf("expected one plan per fingerprint, got %s", logs)
+	}
+	if !strings.Contains(logs, `"full_scans":["explain_users"]`) ||
+		!strings.Contains(logs, `"fingerprint":"select * from `+"`explain_users`"+` where age > ?"`) {
+		t.Fatalf("expected the full scan of the fingerprint, got %s", logs)
+	}
+}
+
+func TestSlowExplainPlugin_Replica(t *testing.T) {
+	w := &syncWriter{}
+	logx.SetWriter(logx.NewWriter(w))
+	defer logx.Reset()
+
+	dir := t.TempDir()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "primary.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica, err := gorm.Open(sqlite.Open(filepath.Join(dir, "replica.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the table is only on the replica, so explaining on the primary fails.
+	if err = replica.AutoMigrate(&explainUser{}); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Use(dbresolver.Register(dbresolver.Config{Replicas: []gorm.Dialector{sqlite.Open(filepath.Join(dir, "replica.db"))}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Use(NewSlowExplainPlugin(time.Nanosecond, WithExplainInterval(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	var users []explainUser
+	if err = db.Where("age > ?", 1).Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for !strings.Contains(w.String(), "slow sql plan") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the plan of the replica to be logged, got %s", w.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err = replica.Exec("CREATE TABLE tx_users (id integer)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Exec("CREATE TABLE tx_users (id integer)").Error; err != nil {
+		t.Fatal(err)
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var n int64
+		return tx.Raw("SELECT count(*) FROM tx_users").Scan(&n).Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	logs := w.String()
+	if strings.Count(logs, "slow sql plan") != 1 || strings.Contains(logs, "failed") {
+		t.Fatalf("expected only the statement outside the transaction to be explained, got %s", logs)
+	}
+}
+
+func TestSummarizePostgresPlan(t *testing.T) {
+	plan := `[{"Plan": {"Node Type": "Nested Loop", "Plan Rows": 10, "Plans": [
+		{"Node Type": "Seq Scan", "Relation Name": "orders", "Plan Rows": 1000},
+		{"Node Type": "Index Scan", "Relation Name": "users", "Index Name": "users_pkey", "Plan Rows": 1}
+	]}}]`
+	summary, err := summarizePostgresPlan([]byte(plan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.FullScans) != 1 || summary.FullScans[0] != "orders" ||
+		len(summary.Indexes) != 1 || summary.Indexes[0] != "users_pkey" || summary.RowsExamined != 1001 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+}
@@ -0,0 +1,242 @@
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"weak"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// TenantPluginName is the name of TenantPlugin.
+	TenantPluginName = "gorm-zero-tenant-plugin"
+
+	defaultTenantColumn      = "tenant_id"
+	callBackTenantScopeName  = "gorm-zero-tenant:scope"
+	callBackTenantCreateName = "gorm-zero-tenant:create"
+)
+
+var (
+	// ErrTenantMismatch is returned when a row is created with the tenant of another one.
+	ErrTenantMismatch = errors.New("tenant of the row does not match the tenant of the context")
+
+	// tenantScoped holds the callbacks of the dbs initialized with a TenantPlugin, without keeping them alive.
+	tenantScoped sync.Map
+)
+
+// TenantPlugin scopes queries, updates and deletes of models that have the tenant column
+// by the tenant of the context, and stamps the tenant column on create. Upserts, like the fallback of Save,
+// leave the rows of other tenants untouched.
+// Without a tenant in the context, these fail with tenant.ErrNoTenant
+// unless the context opted out by tenant.SkipScope. Raw sql is not scoped.
+type TenantPlugin struct {
+	// Column is the tenant column, tenant_id by default.
+	Column string
+}
+
+func (p *TenantPlugin) Name() string {
+	return TenantPluginName
+}
+
+func (p *TenantPlugin) Initialize(db *gorm.DB) error {
+	if len(p.Column) == 0 {
+		p.Column = defaultTenantColumn
+	}
+
+	if err := db.Callback().Query().Before("gorm:query").Register(callBackTenantScopeName, p.scope); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register(callBackTenantScopeName, p.scope); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register(callBackTenantScopeName, p.scopeWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register(callBackTenantScopeName, p.scopeWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().Before("gorm:create").Register(callBackTenantCreateName, p.stamp); err != nil {
+		return err
+	}
+
+	// the callbacks are shared by the sessions of db, unlike its Config.
+	callbacks := db.Callback()
+	if _, loaded := tenantScoped.LoadOrStore(weak.Make(callbacks), struct{}{}); !loaded {
+		runtime.AddCleanup(callbacks, func(key any) {
+			tenantScoped.Delete(key)
+		}, any(weak.Make(callbacks)))
+	}
+	return nil
+}
+
+// UsesTenantPlugin reports whether db, or the db it is a session of, has been initialized with a TenantPlugin.
+// Unlike a lookup in db.Config.Plugins, it is safe while the plugin is being installed.
+func UsesTenantPlugin(db *gorm.DB) bool {
+	_, ok := tenantScoped.Load(weak.Make(db.Callback()))
+	return ok
+}
+
+var _ gorm.Plugin = &TenantPlugin{}
+
+// tenantOf returns the tenant column of the statement model and the tenant of its context,
+// ok is false if the statement is not scoped.
+func (p *TenantPlugin) tenantOf(db *gorm.DB) (field *schema.Field, id string, ok bool) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return nil, "", false
+	}
+	field = db.Statement.Schema.LookUpField(p.Column)
+	if field == nil || tenant.IsScopeSkipped(db.Statement.Context) {
+		return nil, "", false
+	}
+
+	id, ok = tenant.FromContext(db.Statement.Context)
+	if !ok {
+		_ = db.AddError(fmt.Errorf("%w: %s is scoped by %s", tenant.ErrNoTenant, db.Statement.Schema.Table, p.Column))
+		return nil, "", false
+	}
+	return field, id, true
+}
+
+func (p *TenantPlugin) scope(db *gorm.DB) {
+	field, id, ok := p.tenantOf(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: id},
+	}})
+}
+
+// scopeWrite scopes updates and deletes, which gorm rejects without conditions unless AllowGlobalUpdate.
+// The tenant condition must not turn such a global update into an update of every row of the tenant.
+func (p *TenantPlugin) scopeWrite(db *gorm.DB) {
+	if db.Error == nil && missingWhereConditions(db) {
+		_ = db.AddError(gorm.ErrMissingWhereClause)
+		return
+	}
+	p.scope(db)
+}
+
+func missingWhereConditions(db *gorm.DB) bool {
+	if db.AllowGlobalUpdate || db.Statement.Schema == nil {
+		return false
+	}
+	if _, ok := db.Statement.Clauses["WHERE"]; ok {
+		return false
+	}
+
+	// gorm adds the primary keys of the model as conditions.
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Struct:
+		for _, field := range db.Statement.Schema.PrimaryFields {
+			if _, zero := field.ValueOf(db.Statement.Context, rv); !zero {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *TenantPlugin) stamp(db *gorm.DB) {
+	field, id, ok := p.tenantOf(db)
+	if !ok {
+		return
+	}
+
+	ctx := db.Statement.Context
+	stamp := func(rv reflect.Value) {
+		value, zero := field.ValueOf(ctx, rv)
+		if zero {
+			if err := field.Set(ctx, rv, id); err != nil {
+				_ = db.AddError(err)
+			}
+			return
+		}
+		if fmt.Sprint(value) != id {
+			_ = db.AddError(fmt.Errorf("%w: %v", ErrTenantMismatch, value))
+		}
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			stamp(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		stamp(rv)
+	}
+	p.scopeUpsert(db, field, id)
+}
+
+// scopeUpsert keeps the upsert of a create, e.g. the fallback of Save, from updating the row of another
+// tenant that has the same key: that row is left untouched.
+func (p *TenantPlugin) scopeUpsert(db *gorm.DB, field *schema.Field, id string) {
+	c, ok := db.Statement.Clauses["ON CONFLICT"]
+	if !ok {
+		return
+	}
+	onConflict, ok := c.Expression.(clause.OnConflict)
+	if !ok || onConflict.DoNothing || (!onConflict.UpdateAll && len(onConflict.DoUpdates) == 0) {
+		return
+	}
+
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+	if db.Dialector.Name() != "mysql" {
+		onConflict.Where.Exprs = append(onConflict.Where.Exprs, clause.Eq{Column: column, Value: id})
+		db.Statement.AddClause(onConflict)
+		return
+	}
+
+	// ON DUPLICATE KEY UPDATE has no conditions, every assignment keeps the value of another tenant.
+	updates := onConflict.DoUpdates
+	if onConflict.UpdateAll {
+		updates = append(updates, clause.AssignmentColumns(upsertColumns(db.Statement))...)
+	}
+	column.Table = ""
+	guarded := make(clause.Set, 0, len(updates))
+	for _, assignment := range updates {
+		value := assignment.Value
+		if excluded, ok := value.(clause.Column); ok && excluded.Table == "excluded" {
+			value = clause.Expr{SQL: "VALUES(?)", Vars: []interface{}{clause.Column{Name: excluded.Name}}}
+		}
+		guarded = append(guarded, clause.Assignment{
+			Column: assignment.Column,
+			Value: clause.Expr{SQL: "IF(? = ?, ?, ?)", Vars: []interface{}{
+				column, id, value, clause.Column{Name: assignment.Column.Name},
+			}},
+		})
+	}
+	onConflict.UpdateAll, onConflict.DoUpdates = false, guarded
+	db.Statement.AddClause(onConflict)
+}
+
+// upsertColumns returns the columns gorm updates on conflict with UpdateAll.
+func upsertColumns(stmt *gorm.Statement) []string {
+	selectColumns, restricted := stmt.SelectAndOmitColumns(true, true)
+	var columns []string
+	for _, field := range stmt.Schema.Fields {
+		if len(field.DBName) == 0 || !field.Creatable || field.PrimaryKey || field.AutoCreateTime > 0 {
+			continue
+		}
+		if v, ok := selectColumns[field.DBName]; (ok && !v) || (!ok && restricted) {
+			continue
+		}
+		if field.HasDefaultValue && field.DefaultValueInterface == nil && !strings.EqualFold(field.DefaultValue, "NULL") {
+			continue
+		}
+		columns = append(columns, field.DBName)
+	}
+	return columns
+}
@@ -0,0 +1,194 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/tenant"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type tenantOrder struct {
+	Id       uint64 `gorm:"column:id;primaryKey"`
+	TenantId string `gorm:"column:tenant_id"`
+	Name     string `gorm:"column:name"`
+}
+
+type tenantCountry struct {
+	Id   uint64 `gorm:"column:id;primaryKey"`
+	Name string `gorm:"column:name"`
+}
+
+func newTenantDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "tenant.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&tenantOrder{}, &tenantCountry{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Use(&TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := tenant.SkipScope(context.Background())
+	err = db.WithContext(ctx).Create([]tenantOrder{
+		{Id: 1, TenantId: "acme", Name: "a1"},
+		{Id: 2, TenantId: "acme", Name: "a2"},
+		{Id: 3, TenantId: "umbrella", Name: "u1"},
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestTenantPlugin_Scope(t *testing.T) {
+	db := newTenantDB(t)
+	acme := db.WithContext(tenant.WithTenant(context.Background(), "acme"))
+
+	var orders []tenantOrder
+	if err := acme.Find(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 2 {
+		t.Fatalf("expected 2 orders of acme, got %d", len(orders))
+	}
+
+	var count int64
+	if err := acme.Model(&tenantOrder{}).Count(&count).Error; err != nil || count != 2 {
+		t.Fatalf("expected count 2, got %d, %v", count, err)
+	}
+
+	var order tenantOrder
+	if err := acme.Take(&order, 3).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected order of another tenant to be invisible, got %v", err)
+	}
+
+	res := acme.Model(&tenantOrder{}).Where("id IN ?", []int{1, 3}).Update("name", "x")
+	if res.Error != nil || res.RowsAffected != 1 {
+		t.Fatalf("expected 1 updated row, got %d, %v", res.RowsAffected, res.Error)
+	}
+	res = acme.Delete(&tenantOrder{Id: 3})
+	if res.Error != nil || res.RowsAffected != 0 {
+		t.Fatalf("expected no deleted row, got %d, %v", res.RowsAffected, res.Error)
+	}
+
+	// the tenant condition does not lift the guard on global updates.
+	err := acme.Model(&tenantOrder{}).Update("name", "y").Error
+	if !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("expected ErrMissingWhereClause, got %v", err)
+	}
+}
+
+func TestTenantPlugin_Create(t *testing.T) {
+	db := newTenantDB(t)
+	acme := db.WithContext(tenant.WithTenant(context.Background(), "acme"))
+
+	order := tenantOrder{Id: 4, Name: "a3"}
+	if err := acme.Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.TenantId != "acme" {
+		t.Fatalf("expected tenant to be stamped, got %q", order.TenantId)
+	}
+
+	orders := []*tenantOrder{{Id: 5}, {Id: 6, TenantId: "acme"}}
+	if err := acme.Create(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if orders[0].TenantId != "acme" {
+		t.Fatalf("expected tenant to be stamped on every row, got %q", orders[0].TenantId)
+	}
+
+	err := acme.Create(&tenantOrder{Id: 7, TenantId: "umbrella"}).Error
+	if !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("expected ErrTenantMismatch, got %v", err)
+	}
+}
+
+func TestTenantPlugin_NoTenant(t *testing.T) {
+	db := newTenantDB(t)
+
+	var orders []tenantOrder
+	if err := db.Find(&orders).Error; !errors.Is(err, tenant.ErrNoTenant) {
+		t.Fatalf("expected ErrNoTenant, got %v", err)
+	}
+	if err := db.Create(&tenantOrder{Id: 4}).Error; !errors.Is(err, tenant.ErrNoTenant) {
+		t.Fatalf("expected ErrNoTenant, got %v", err)
+	}
+
+	ctx := tenant.SkipScope(context.Background())
+	if err := db.WithContext(ctx).Find(&orders).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orders) != 3 {
+		t.Fatalf("expected all 3 orders, got %d", len(orders))
+	}
+
+	// models without the tenant column are not scoped.
+	if err := db.Create(&tenantCountry{Id: 1, Name: "nl"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var countries []tenantCountry
+	if err := db.Find(&countries).Error; err != nil || len(countries) != 1 {
+		t.Fatalf("expected 1 country, got %d, %v", len(countries), err)
+	}
+}
+
+func TestTenantPlugin_Save(t *testing.T) {
+	db := newTenantDB(t)
+	acme := db.WithContext(tenant.WithTenant(context.Background(), "acme"))
+
+	if err := acme.Save(&tenantOrder{Id: 3, Name: "hijacked"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := acme.Save(&[]tenantOrder{{Id: 3, Name: "hijacked"}, {Id: 1, Name: "saved"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var order tenantOrder
+	if err := db.WithContext(tenant.SkipScope(context.Background())).Take(&order, 3).Error; err != nil {
+		t.Fatal(err)
+	}
+	if order.TenantId != "umbrella" || order.Name != "u1" {
+		t.Fatalf("expected the order of another tenant to be untouched, got %+v", order)
+	}
+	var saved tenantOrder
+	if err := acme.Take(&saved, 1).Error; err != nil || saved.Name != "saved" {
+		t.Fatalf("expected the order of the tenant to be saved, got %+v, %v", saved, err)
+	}
+
+	if err := acme.Save(&tenantOrder{Id: 8, Name: "new"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var created tenantOrder
+	if err := acme.Take(&created, 8).Error; err != nil || created.TenantId != "acme" {
+		t.Fatalf("expected a new order of the tenant, got %+v, %v", created, err)
+	}
+}
+
+func TestTenantPlugin_SaveMysql(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:pass@tcp(127.0.0.1:3306)/db", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Use(&TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	stmt := db.WithContext(tenant.WithTenant(context.Background(), "acme")).
+		Clauses(clause.OnConflict{UpdateAll: true}).Create(&[]tenantOrder{{Id: 3, Name: "hijacked"}}).Statement
+	sql := stmt.SQL.String()
+	want := "ON DUPLICATE KEY UPDATE `tenant_id`=IF(`tenant_id` = ?, VALUES(`tenant_id`), `tenant_id`)," +
+		"`name`=IF(`tenant_id` = ?, VALUES(`name`), `name`)"
+	if !strings.HasSuffix(sql, want) {
+		t.Fatalf("expected the updates to be guarded by the tenant, got %s %v", sql, stmt.Error)
+	}
+}
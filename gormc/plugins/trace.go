@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/SpectatorNan/gorm-zero/gormc/logger"
 	"github.com/zeromicro/go-zero/core/trace"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -78,10 +79,23 @@ func after(db *gorm.DB) {
 	span.AddEvent(spanEventName, oteltrace.WithAttributes(
 		spanAttrTable.String(db.Statement.Table),
 		spanAttrRowsAffected.Int64(db.RowsAffected),
-		spanAttrSql.String(db.Dialector.Explain(db.Statement.SQL.String(), db.Statement.Vars...)),
+		spanAttrSql.String(explainSql(db)),
 	))
 }
 
+// explainSql returns the sql of db, filtered and redacted like the logs if the logger of db redacts them.
+func explainSql(db *gorm.DB) string {
+	sql, vars := db.Statement.SQL.String(), db.Statement.Vars
+	if filter, ok := db.Logger.(gorm.ParamsFilter); ok {
+		sql, vars = filter.ParamsFilter(db.Statement.Context, sql, vars...)
+	}
+	sql = db.Dialector.Explain(sql, vars...)
+	if redactor, ok := db.Logger.(logger.SqlRedactor); ok {
+		sql = redactor.RedactSql(sql)
+	}
+	return sql
+}
+
 func startSpan(ctx context.Context) (context.Context, oteltrace.Span) {
 	// tracer := otel.Tracer(trace.TraceName)
 	tracer := trace.TracerFromContext(ctx)
@@ -0,0 +1,38 @@
+package plugins
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/logger"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+type traceUser struct {
+	Id       uint64 `gorm:"column:id;primaryKey"`
+	Password string `gorm:"column:password"`
+}
+
+func TestExplainSql(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.db")
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	find := func(db *gorm.DB) string {
+		var user traceUser
+		return explainSql(db.Session(&gorm.Session{DryRun: true}).Where("password = ?", "secret").Find(&user))
+	}
+
+	if sql := find(db); sql != "SELECT * FROM `trace_users` WHERE password = \"secret\"" {
+		t.Fatalf("expected the explained sql, got %s", sql)
+	}
+
+	db.Logger = logger.NewZeroLog(gormLogger.Config{}, logger.WithRedactor(
+		logger.NewRedactor(logger.RedactColumns("password"), logger.RedactParameterized())))
+	if sql := find(db); sql != "SELECT * FROM `trace_users` WHERE password = ? -- args: [\"xxxxx\"]" {
+		t.Fatalf("expected the redacted sql, got %s", sql)
+	}
+}
@@ -0,0 +1,98 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/stores/cache"
+)
+
+// ErrCacheSkipped is returned by the Get of a cache.Cache of NewCache for a ctx that skips the scope,
+// IsNotFound reports it as a miss.
+var ErrCacheSkipped = errors.New("cache is skipped for contexts that skip the tenant scope")
+
+// prefixedCache prefixes the keys with the tenant of ctx, so tenants never share cached rows.
+type prefixedCache struct {
+	cache cache.Cache
+}
+
+// NewCache returns a cache.Cache that prefixes every key with the tenant of ctx,
+// methods without a ctx use the keys as is.
+// A ctx of SkipScope bypasses the cache: its rows may belong to any tenant, so they are queried
+// but neither read from nor written to the cache. Deletes still apply.
+func NewCache(c cache.Cache) cache.Cache {
+	return prefixedCache{cache: c}
+}
+
+func (c prefixedCache) Del(keys ...string) error {
+	return c.DelCtx(context.Background(), keys...)
+}
+
+func (c prefixedCache) DelCtx(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, Key(ctx, key))
+	}
+	return c.cache.DelCtx(ctx, prefixed...)
+}
+
+func (c prefixedCache) Get(key string, val any) error {
+	return c.GetCtx(context.Background(), key, val)
+}
+
+func (c prefixedCache) GetCtx(ctx context.Context, key string, val any) error {
+	if IsScopeSkipped(ctx) {
+		return ErrCacheSkipped
+	}
+	return c.cache.GetCtx(ctx, Key(ctx, key), val)
+}
+
+func (c prefixedCache) IsNotFound(err error) bool {
+	return errors.Is(err, ErrCacheSkipped) || c.cache.IsNotFound(err)
+}
+
+func (c prefixedCache) Set(key string, val any) error {
+	return c.SetCtx(context.Background(), key, val)
+}
+
+func (c prefixedCache) SetCtx(ctx context.Context, key string, val any) error {
+	if IsScopeSkipped(ctx) {
+		return nil
+	}
+	return c.cache.SetCtx(ctx, Key(ctx, key), val)
+}
+
+func (c prefixedCache) SetWithExpire(key string, val any, expire time.Duration) error {
+	return c.SetWithExpireCtx(context.Background(), key, val, expire)
+}
+
+func (c prefixedCache) SetWithExpireCtx(ctx context.Context, key string, val any, expire time.Duration) error {
+	if IsScopeSkipped(ctx) {
+		return nil
+	}
+	return c.cache.SetWithExpireCtx(ctx, Key(ctx, key), val, expire)
+}
+
+func (c prefixedCache) Take(val any, key string, query func(val any) error) error {
+	return c.TakeCtx(context.Background(), val, key, query)
+}
+
+func (c prefixedCache) TakeCtx(ctx context.Context, val any, key string, query func(val any) error) error {
+	if IsScopeSkipped(ctx) {
+		return query(val)
+	}
+	return c.cache.TakeCtx(ctx, val, Key(ctx, key), query)
+}
+
+func (c prefixedCache) TakeWithExpire(val any, key string, query func(val any, expire time.Duration) error) error {
+	return c.TakeWithExpireCtx(context.Background(), val, key, query)
+}
+
+func (c prefixedCache) TakeWithExpireCtx(ctx context.Context, val any, key string,
+	query func(val any, expire time.Duration) error) error {
+	if IsScopeSkipped(ctx) {
+		return query(val, 0)
+	}
+	return c.cache.TakeWithExpireCtx(ctx, val, Key(ctx, key), query)
+}
@@ -0,0 +1,46 @@
+// Package tenant carries the tenant of a request in its context.
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoTenant is returned when a tenant is required but the context carries none.
+var ErrNoTenant = errors.New("no tenant in context")
+
+type (
+	tenantKey    struct{}
+	skipScopeKey struct{}
+)
+
+// WithTenant returns a copy of ctx that carries the tenant id.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// FromContext returns the tenant id carried by ctx.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantKey{}).(string)
+	return id, ok && len(id) > 0
+}
+
+// SkipScope returns a copy of ctx whose queries are not scoped by tenant,
+// the explicit opt-out for cross-tenant access like admin jobs.
+func SkipScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipScopeKey{}, true)
+}
+
+// IsScopeSkipped reports whether ctx opted out of the tenant scope.
+func IsScopeSkipped(ctx context.Context) bool {
+	skipped, _ := ctx.Value(skipScopeKey{}).(bool)
+	return skipped
+}
+
+// Key prefixes key with the tenant id carried by ctx, key is returned as is without a tenant.
+func Key(ctx context.Context, key string) string {
+	if id, ok := FromContext(ctx); ok {
+		return "tenant:" + id + ":" + key
+	}
+	return key
+}
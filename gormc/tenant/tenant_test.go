@@ -0,0 +1,76 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"github.com/zeromicro/go-zero/core/syncx"
+)
+
+func TestFromContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Fatal("expected no tenant")
+	}
+	if _, ok := FromContext(WithTenant(context.Background(), "")); ok {
+		t.Fatal("expected an empty tenant to be no tenant")
+	}
+	ctx := WithTenant(context.Background(), "acme")
+	if id, ok := FromContext(ctx); !ok || id != "acme" {
+		t.Fatalf("expected acme, got %s", id)
+	}
+	if key := Key(ctx, "cache:user:1"); key != "tenant:acme:cache:user:1" {
+		t.Fatalf("unexpected key %s", key)
+	}
+	if key := Key(context.Background(), "cache:user:1"); key != "cache:user:1" {
+		t.Fatalf("unexpected key %s", key)
+	}
+}
+
+func TestCache(t *testing.T) {
+	rds := redis.New(miniredis.RunT(t).Addr())
+	c := NewCache(cache.NewNode(rds, syncx.NewSingleFlight(), cache.NewStat("tenant-test"), errNotFound))
+
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+	if err := c.SetCtx(acme, "key", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetCtx(globex, "key", "g"); err != nil {
+		t.Fatal(err)
+	}
+
+	var v string
+	if err := c.GetCtx(acme, "key", &v); err != nil || v != "a" {
+		t.Fatalf("expected a, got %s %v", v, err)
+	}
+	if err := c.DelCtx(acme, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.GetCtx(acme, "key", &v); !c.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if err := c.GetCtx(globex, "key", &v); err != nil || v != "g" {
+		t.Fatalf("expected g, got %s %v", v, err)
+	}
+
+	skipped := SkipScope(globex)
+	if err := c.GetCtx(skipped, "key", &v); !c.IsNotFound(err) {
+		t.Fatalf("expected a ctx skipping the scope to miss, got %v", err)
+	}
+	err := c.TakeCtx(skipped, &v, "other", func(val any) error {
+		*val.(*string) = "queried"
+		return nil
+	})
+	if err != nil || v != "queried" {
+		t.Fatalf("expected queried, got %s %v", v, err)
+	}
+	if ok, _ := rds.Exists("tenant:globex:other"); ok {
+		t.Fatal("expected a ctx skipping the scope not to be cached")
+	}
+}
+
+var errNotFound = errors.New("not found")
@@ -0,0 +1,242 @@
+package gormc
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/config"
+	"github.com/SpectatorNan/gorm-zero/gormc/tenant"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/syncx"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMaxTenants        = 100
+	defaultTenantIdleTimeout = 10 * time.Minute
+)
+
+type (
+	// TenantOpenFunc opens the database of a tenant, e.g. with mysql.Connect.
+	TenantOpenFunc func(tenantID string) (*gorm.DB, error)
+
+	// TenantRouterOption customizes a TenantRouter.
+	TenantRouterOption func(r *TenantRouter)
+
+	// TenantRouter routes a ctx to the database of its tenant, set by tenant.WithTenant.
+	// Databases are opened on first use and kept in a LRU, the least recently used one is evicted
+	// when there are too many, and those idle longer than the idle timeout are evicted on next use.
+	// An evicted database is closed once it has no leases, see Acquire.
+	TenantRouter struct {
+		open        TenantOpenFunc
+		maxTenants  int
+		idleTimeout time.Duration
+
+		mu      sync.Mutex
+		lru     *list.List
+		tenants map[string]*list.Element
+		barrier syncx.SingleFlight
+	}
+
+	tenantDB struct {
+		id       string
+		db       *gorm.DB
+		lastUsed time.Time
+		leases   int
+		// evicted is the reason of the eviction, empty while in the lru.
+		evicted string
+	}
+)
+
+// NewTenantRouter returns a TenantRouter that opens the database of a tenant with open.
+func NewTenantRouter(open TenantOpenFunc, opts ...TenantRouterOption) *TenantRouter {
+	r := &TenantRouter{
+		open:        open,
+		maxTenants:  defaultMaxTenants,
+		idleTimeout: defaultTenantIdleTimeout,
+		lru:         list.New(),
+		tenants:     make(map[string]*list.Element),
+		barrier:     syncx.NewSingleFlight(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithMaxTenants sets the max number of open tenant databases.
+func WithMaxTenants(n int) TenantRouterOption {
+	return func(r *TenantRouter) {
+		if n > 0 {
+			r.maxTenants = n
+		}
+	}
+}
+
+// WithTenantIdleTimeout sets how long an unused tenant database is kept open.
+func WithTenantIdleTimeout(timeout time.Duration) TenantRouterOption {
+	return func(r *TenantRouter) {
+		if timeout > 0 {
+			r.idleTimeout = timeout
+		}
+	}
+}
+
+// DB returns the database of the tenant in ctx, opening it if needed.
+// The database is closed once evicted, use Acquire to keep it open while in use.
+func (r *TenantRouter) DB(ctx context.Context) (*gorm.DB, error) {
+	t, err := r.acquire(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return t.db, nil
+}
+
+// Acquire returns the database of the tenant in ctx with a lease, opening it if needed.
+// An evicted database is closed once all its leases are released, release must be called when done.
+func (r *TenantRouter) Acquire(ctx context.Context) (db *gorm.DB, release func(), err error) {
+	t, err := r.acquire(ctx, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	var once sync.Once
+	return t.db, func() {
+		once.Do(func() {
+			r.release(t)
+		})
+	}, nil
+}
+
+func (r *TenantRouter) acquire(ctx context.Context, lease bool) (*tenantDB, error) {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrNoTenant
+	}
+
+	// the opened database may be evicted by other tenants before it is leased, then it is opened again.
+	for {
+		if t, ok := r.get(id, lease); ok {
+			return t, nil
+		}
+		_, err := r.barrier.Do(id, func() (any, error) {
+			if _, ok := r.get(id, false); ok {
+				return nil, nil
+			}
+			db, err := r.open(id)
+			if err != nil {
+				return nil, err
+			}
+			registerWriteRecorder(db)
+			r.add(id, db)
+			return nil, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Len returns the number of open tenant databases.
+func (r *TenantRouter) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lru.Len()
+}
+
+// Close closes every tenant database, the leased ones once released.
+func (r *TenantRouter) Close() {
+	r.mu.Lock()
+	var evicted []*tenantDB
+	for e := r.lru.Back(); e != nil; e = r.lru.Back() {
+		evicted = r.evict(evicted, e, "router closed")
+	}
+	r.mu.Unlock()
+	closeTenants(evicted)
+}
+
+func (r *TenantRouter) get(id string, lease bool) (*tenantDB, bool) {
+	now := time.Now()
+	r.mu.Lock()
+	evicted := r.evictIdle(now)
+	e, ok := r.tenants[id]
+	var t *tenantDB
+	if ok {
+		r.lru.MoveToFront(e)
+		t = e.Value.(*tenantDB)
+		t.lastUsed = now
+		if lease {
+			t.leases++
+		}
+	}
+	r.mu.Unlock()
+
+	closeTenants(evicted)
+	return t, ok
+}
+
+func (r *TenantRouter) add(id string, db *gorm.DB) {
+	r.mu.Lock()
+	r.tenants[id] = r.lru.PushFront(&tenantDB{id: id, db: db, lastUsed: time.Now()})
+	var evicted []*tenantDB
+	for r.lru.Len() > r.maxTenants {
+		evicted = r.evict(evicted, r.lru.Back(), "least recently used")
+	}
+	r.mu.Unlock()
+	closeTenants(evicted)
+}
+
+func (r *TenantRouter) release(t *tenantDB) {
+	r.mu.Lock()
+	t.leases--
+	closing := len(t.evicted) > 0 && t.leases == 0
+	r.mu.Unlock()
+
+	if closing {
+		closeTenants([]*tenantDB{t})
+	}
+}
+
+// evictIdle removes the idle tenants from the back of the lru, r.mu must be held.
+func (r *TenantRouter) evictIdle(now time.Time) []*tenantDB {
+	var evicted []*tenantDB
+	for e := r.lru.Back(); e != nil; e = r.lru.Back() {
+		if now.Sub(e.Value.(*tenantDB).lastUsed) < r.idleTimeout {
+			break
+		}
+		evicted = r.evict(evicted, e, "idle")
+	}
+	return evicted
+}
+
+// evict removes the tenant of e from the lru and appends it to closing if it has no leases,
+// the leased ones are closed on their last release. r.mu must be held.
+func (r *TenantRouter) evict(closing []*tenantDB, e *list.Element, reason string) []*tenantDB {
+	t := r.lru.Remove(e).(*tenantDB)
+	delete(r.tenants, t.id)
+	t.evicted = reason
+	if t.leases > 0 {
+		return closing
+	}
+	return append(closing, t)
+}
+
+// closeTenants closes the databases outside the lock, closing waits for running queries.
+func closeTenants(tenants []*tenantDB) {
+	for _, t := range tenants {
+		if err := config.CloseDB(t.db); err != nil {
+			logx.Errorf("close database of tenant %s: %v", t.id, err)
+			continue
+		}
+		logx.Infof("closed database of tenant %s: %s", t.id, t.evicted)
+	}
+}
+
+// tenantKey prefixes key with the tenant of ctx for tenant conns, as their cache does.
+func (cc CachedConn) tenantKey(ctx context.Context, key string) string {
+	if !cc.usesTenantKeys() {
+		return key
+	}
+	return tenant.Key(ctx, key)
+}
@@ -0,0 +1,310 @@
+package gormc
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SpectatorNan/gorm-zero/gormc/plugins"
+	"github.com/SpectatorNan/gorm-zero/gormc/tenant"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/zeromicro/go-zero/core/stores/cache"
+	"github.com/zeromicro/go-zero/core/stores/redis"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type tenantUser struct {
+	Id   uint64 `gorm:"column:id;primaryKey"`
+	Name string `gorm:"column:name"`
+}
+
+// newTestTenantRouter opens a sqlite database per tenant with a user named after the tenant.
+func newTestTenantRouter(t *testing.T, opened *atomic.Int32, opts ...TenantRouterOption) *TenantRouter {
+	dir := t.TempDir()
+	r := NewTenantRouter(func(id string) (*gorm.DB, error) {
+		opened.Add(1)
+		db, err := gorm.Open(sqlite.Open(filepath.Join(dir, id+".db")), &gorm.Config{})
+		if err != nil {
+			return nil, err
+		}
+		if err = db.AutoMigrate(&tenantUser{}); err != nil {
+			return nil, err
+		}
+		return db, db.Save(&tenantUser{Id: 1, Name: id}).Error
+	}, opts...)
+	t.Cleanup(r.Close)
+	return r
+}
+
+func isClosed(db *gorm.DB) bool {
+	sqldb, _ := db.DB()
+	return sqldb.Ping() != nil
+}
+
+func TestTenantRouter_DB(t *testing.T) {
+	var opened atomic.Int32
+	r := newTestTenantRouter(t, &opened)
+
+	if _, err := r.DB(context.Background()); !errors.Is(err, tenant.ErrNoTenant) {
+		t.Fatalf("expected ErrNoTenant, got %v", err)
+	}
+
+	ctx := tenant.WithTenant(context.Background(), "acme")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.DB(ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if opened.Load() != 1 || r.Len() != 1 {
+		t.Fatalf("expected the tenant database to be opened once, got %d", opened.Load())
+	}
+}
+
+func TestTenantRouter_Eviction(t *testing.T) {
+	var opened atomic.Int32
+	r := newTestTenantRouter(t, &opened, WithMaxTenants(2), WithTenantIdleTimeout(100*time.Millisecond))
+	dbOf := func(id string) *gorm.DB {
+		db, err := r.DB(tenant.WithTenant(context.Background(), id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+
+	a := dbOf("a")
+	dbOf("b")
+	dbOf("a")
+	b := dbOf("b")
+	c := dbOf("c")
+	if r.Len() != 2 || !isClosed(a) || isClosed(b) || isClosed(c) {
+		t.Fatal("expected the least recently used tenant to be closed")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	dbOf("d")
+	if r.Len() != 1 || !isClosed(b) || !isClosed(c) {
+		t.Fatal("expected idle tenants to be closed")
+	}
+	if opened.Load() != 4 {
+		t.Fatalf("expected 4 opened databases, got %d", opened.Load())
+	}
+}
+
+func TestTenantRouter_Acquire(t *testing.T) {
+	var opened atomic.Int32
+	r := newTestTenantRouter(t, &opened, WithMaxTenants(1))
+
+	a, release, err := r.Acquire(tenant.WithTenant(context.Background(), "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.DB(tenant.WithTenant(context.Background(), "b")); err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 1 || isClosed(a) {
+		t.Fatal("expected the leased tenant to be evicted but kept open")
+	}
+	release()
+	release()
+	if !isClosed(a) {
+		t.Fatal("expected the evicted tenant to be closed on release")
+	}
+}
+
+func TestTenantConn_Eviction(t *testing.T) {
+	var opened atomic.Int32
+	r := newTestTenantRouter(t, &opened, WithMaxTenants(1))
+	conn := NewTenantConnNoCache(r)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			var user tenantUser
+			err := conn.QueryNoCacheCtx(tenant.WithTenant(context.Background(), id), func(conn *gorm.DB) error {
+				// other tenants evict this one meanwhile.
+				time.Sleep(20 * time.Millisecond)
+				return conn.Take(&user, 1).Error
+			})
+			if err != nil || user.Name != id {
+				t.Errorf("expected the user of %s, got %s %v", id, user.Name, err)
+			}
+		}(string(rune('a' + i%4)))
+	}
+	wg.Wait()
+	if r.Len() != 1 {
+		t.Fatalf("expected 1 open tenant, got %d", r.Len())
+	}
+}
+
+func TestTenantConn(t *testing.T) {
+	var opened atomic.Int32
+	r := newTestTenantRouter(t, &opened)
+	rds := redis.New(miniredis.RunT(t).Addr())
+	cc := NewTenantConnWithCache(r, cache.NewNode(rds, singleFlights, stats, ErrNotFound))
+
+	query := func(ctx context.Context) (string, error) {
+		var user tenantUser
+		err := cc.QueryCtx(ctx, &user, "cache:user:1", func(conn *gorm.DB) error {
+			return conn.Take(&user, 1).Error
+		})
+		return user.Name, err
+	}
+
+	for _, id := range []string{"acme", "globex", "acme"} {
+		name, err := query(tenant.WithTenant(context.Background(), id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != id {
+			t.Fatalf("expected the user of %s, got %s", id, name)
+		}
+	}
+	if ok, _ := rds.Exists("tenant:globex:cache:user:1"); !ok {
+		t.Fatal("expected the cache key to be prefixed by the tenant")
+	}
+	if _, err := query(context.Background()); !errors.Is(err, tenant.ErrNoTenant) {
+		t.Fatalf("expected ErrNoTenant, got %v", err)
+	}
+
+	conn := NewTenantConnNoCache(r)
+	var user tenantUser
+	err := conn.QueryNoCacheCtx(tenant.WithTenant(context.Background(), "globex"), func(conn *gorm.DB) error {
+		return conn.Take(&user, 1).Error
+	})
+	if err != nil || user.Name != "globex" {
+		t.Fatalf("expected the user of globex, got %s %v", user.Name, err)
+	}
+}
+
+type sharedTenantUser struct {
+	Id       uint64 `gorm:"column:id;primaryKey"`
+	TenantId string `gorm:"column:tenant_id"`
+	Name     string `gorm:"column:name"`
+}
+
+func TestConn_TenantPlugin(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "shared.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&sharedTenantUser{}); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Use(&plugins.TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	rds := redis.New(miniredis.RunT(t).Addr())
+	cc := NewNodeConn(db, rds)
+
+	ctx := tenant.WithTenant(context.Background(), "acme")
+	err = cc.ExecCtx(ctx, func(conn *gorm.DB) error {
+		return conn.Create(&sharedTenantUser{Id: 1, Name: "a"}).Error
+	}, "cache:user:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var user sharedTenantUser
+	err = cc.QueryCtx(ctx, &user, "cache:user:1", func(conn *gorm.DB) error {
+		return conn.Take(&user, 1).Error
+	})
+	if err != nil || user.TenantId != "acme" {
+		t.Fatalf("expected the user of acme, got %q %v", user.TenantId, err)
+	}
+	if ok, _ := rds.Exists("tenant:acme:cache:user:1"); !ok {
+		t.Fatal("expected the cache key to be prefixed by the tenant")
+	}
+
+	err = cc.QueryCtx(tenant.WithTenant(context.Background(), "globex"), &user, "cache:user:1", func(conn *gorm.DB) error {
+		return conn.Take(&user, 1).Error
+	})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the user of acme to be invisible to globex, got %v", err)
+	}
+}
+
+func TestConn_TenantPluginSkipScope(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "shared.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&sharedTenantUser{}); err != nil {
+		t.Fatal(err)
+	}
+	rds := redis.New(miniredis.RunT(t).Addr())
+	// the plugin is installed after the conn is created.
+	cc := NewNodeConn(db, rds)
+	if err = db.Use(&plugins.TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	acme := tenant.WithTenant(context.Background(), "acme")
+	globex := tenant.WithTenant(context.Background(), "globex")
+	if err = db.WithContext(globex).Create(&sharedTenantUser{Id: 2, Name: "g"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var user sharedTenantUser
+	err = cc.QueryCtx(tenant.SkipScope(acme), &user, "cache:user:2", func(conn *gorm.DB) error {
+		return conn.Take(&user, 2).Error
+	})
+	if err != nil || user.TenantId != "globex" {
+		t.Fatalf("expected the user of globex, got %q %v", user.TenantId, err)
+	}
+	if keys := redisKeys(t, rds); len(keys) > 0 {
+		t.Fatalf("expected a query skipping the scope to bypass the cache, got %v", keys)
+	}
+
+	err = cc.QueryCtx(acme, &user, "cache:user:2", func(conn *gorm.DB) error {
+		return conn.Take(&user, 2).Error
+	})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the user of globex to be invisible to acme, got %v", err)
+	}
+	if ok, _ := rds.Exists("tenant:acme:cache:user:2"); !ok {
+		t.Fatal("expected the cache key to be prefixed by the tenant")
+	}
+}
+
+func TestConn_TenantPluginInstalledConcurrently(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "shared.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := NewNodeConn(db, redis.New(miniredis.RunT(t).Addr()))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for cc.cacheOf() != cc.tenantCache {
+		}
+	}()
+	if err = db.Use(&plugins.TenantPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if !plugins.UsesTenantPlugin(db.Session(&gorm.Session{})) {
+		t.Fatal("expected sessions of db to use the tenant plugin")
+	}
+}
+
+func redisKeys(t *testing.T, rds *redis.Redis) []string {
+	keys, err := rds.Keys("*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	sqlCommentRegex = regexp.MustCompile(`(?s)^\s*(?:/\*.*?\*/|--[^\n]*\n|\s)*`)
+	sqlTableRegex   = regexp.MustCompile("(?i)\\b(?:from|into|update|join)\\s+([`\"\\[]?[\\w$]+(?:[`\"\\]]?\\.[`\"\\[]?[\\w$]+)?[`\"\\]]?)")
+
+	sqlCommentsRegex = regexp.MustCompile(`(?s)/\*.*?\*/|--[^\n]*`)
+	sqlStringRegex   = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	sqlValueRegex    = regexp.MustCompile(`\$\d+|\b\d+(?:\.\d+)?\b`)
+	sqlListRegex     = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	sqlTuplesRegex   = regexp.MustCompile(`\(\.\.\.\)(?:\s*,\s*\(\.\.\.\))+`)
+	sqlSpaceRegex    = regexp.MustCompile(`\s+`)
+)
+
+// SqlOperation returns the first keyword of sql in lower case, e.g. select, insert, update or delete.
+func SqlOperation(sql string) string {
+	sql = sqlCommentRegex.ReplaceAllString(sql, "")
+	end := strings.IndexFunc(sql, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+	})
+	if end < 0 {
+		end = len(sql)
+	}
+	return strings.ToLower(sql[:end])
+}
+
+// SqlTable returns the first table of sql without quotes, e.g. users of SELECT * FROM `users`.
+// It is a best effort for logs, the table of a statement like SELECT 1 is empty.
+func SqlTable(sql string) string {
+	match := sqlTableRegex.FindStringSubmatch(sql)
+	if match == nil {
+		return ""
+	}
+	return strings.NewReplacer("`", "", `"`, "", "[", "", "]", "").Replace(match[1])
+}
+
+// SqlFingerprint returns the shape of sql: comments are removed, literals and placeholders become ?,
+// lists like IN (?,?) and the tuples of a batch insert become (...), and the rest is lower case.
+// Statements that differ only by their values have the same fingerprint.
+func SqlFingerprint(sql string) string {
+	sql = sqlCommentsRegex.ReplaceAllString(sql, " ")
+	sql = sqlStringRegex.ReplaceAllString(sql, "?")
+	sql = sqlValueRegex.ReplaceAllString(sql, "?")
+	sql = sqlListRegex.ReplaceAllString(sql, "(...)")
+	sql = sqlTuplesRegex.ReplaceAllString(sql, "(...)")
+	sql = sqlSpaceRegex.ReplaceAllString(sql, " ")
+	return strings.ToLower(strings.TrimSpace(sql))
+}
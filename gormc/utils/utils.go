@@ -41,16 +41,31 @@ func gormZeroSourceDirPath(file string) string {
 
 // FileWithLineNum return the file name and line number of the current file
 func FileWithLineNum() string {
+	caller, _ := callerOutsideGorm(3)
+	return caller
+}
+
+// CallerSkip returns FileWithLineNum and how many frames it is above the caller of CallerSkip,
+// e.g. for logx's WithCallerSkip.
+func CallerSkip() (caller string, skip int) {
+	caller, i := callerOutsideGorm(3)
+	if i < 0 {
+		return "", 0
+	}
+	return caller, i - 2
+}
 
-	// the second caller usually from gorm internal, so set i start from 2
-	for i := 2; i < 15; i++ {
+// callerOutsideGorm returns the first caller not in gorm or gorm-zero, and its depth for runtime.Caller.
+func callerOutsideGorm(start int) (string, int) {
+	// the second caller usually from gorm internal, so set i start from 2 above the caller
+	for i := start; i < start+13; i++ {
 		_, file, line, ok := runtime.Caller(i)
 		inGorm := strings.Contains(file, "gorm.io")
 		inGormZero := strings.HasPrefix(file, gormZeroSourceDir)
 		if ok && (!(inGorm || inGormZero) || strings.HasSuffix(file, "_test.go")) {
-			return file + ":" + strconv.FormatInt(int64(line), 10)
+			return file + ":" + strconv.FormatInt(int64(line), 10), i
 		}
 	}
 
-	return ""
+	return "", -1
 }
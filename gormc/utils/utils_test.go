@@ -17,3 +17,46 @@ func TestContain(t *testing.T) {
 	contain2 := strings.Contains(str2, "/Users/spec/Documents/GitHub/gorm-zero/")
 	t.Log(contain2)
 }
+
+func TestSqlOperationAndTable(t *testing.T) {
+	cases := []struct {
+		sql       string
+		operation string
+		table     string
+	}{
+		{"SELECT * FROM `users` WHERE `id` = 1", "select", "users"},
+		{"  /* trace */ insert INTO \"public\".\"orders\" (id) VALUES (1)", "insert", "public.orders"},
+		{"UPDATE [users] SET name = 'a'", "update", "users"},
+		{"DELETE FROM users WHERE id = 1", "delete", "users"},
+		{"-- comment\nSELECT 1", "select", ""},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		if op := SqlOperation(c.sql); op != c.operation {
+			t.Errorf("SqlOperation(%q) = %q, want %q", c.sql, op, c.operation)
+		}
+		if table := SqlTable(c.sql); table != c.table {
+			t.Errorf("SqlTable(%q) = %q, want %q", c.sql, table, c.table)
+		}
+	}
+}
+
+func TestSqlFingerprint(t *testing.T) {
+	cases := []struct {
+		sql         string
+		fingerprint string
+	}{
+		{"SELECT * FROM `users` WHERE `id` = 1 AND name = 'nan'", "select * from `users` where `id` = ? and name = ?"},
+		{"/* trace */ SELECT *\n  FROM users WHERE id IN (?,?, ?) LIMIT 10", "select * from users where id in (...) limit ?"},
+		{`SELECT * FROM "t1" WHERE "id" = $1 AND note = 'it''s'`, `select * from "t1" where "id" = ? and note = ?`},
+		{"INSERT INTO users (id,name) VALUES (?,?),(?,?) -- batch", "insert into users (id,name) values (...)"},
+	}
+	for _, c := range cases {
+		if fingerprint := SqlFingerprint(c.sql); fingerprint != c.fingerprint {
+			t.Errorf("SqlFingerprint(%q) = %q, want %q", c.sql, fingerprint, c.fingerprint)
+		}
+	}
+	if SqlFingerprint("SELECT * FROM users WHERE id IN (1,2)") != SqlFingerprint("select * from users where id in (3)") {
+		t.Error("expected statements that differ by their values to have the same fingerprint")
+	}
+}
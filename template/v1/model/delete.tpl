@@ -13,11 +13,13 @@ func (m *default{{.upperStartCamelObject}}Model) Delete(ctx context.Context, tx
             db = tx
         }
         return db.Delete(&{{.upperStartCamelObject}}{}, {{.lowerStartCamelPrimaryKey}}).Error
-	}, m.GetCacheKeys(data)...){{else}} db := m.conn
-        if tx != nil {
-            db = tx
-        }
-        err:= db.WithContext(ctx).Delete(&{{.upperStartCamelObject}}{}, {{.lowerStartCamelPrimaryKey}}).Error
+	}, m.GetCacheKeys(data)...){{else}}err := m.ExecNoCacheCtx(ctx, func(conn *gorm.DB) error {
+		db := conn
+		if tx != nil {
+			db = tx
+		}
+		return db.Delete(&{{.upperStartCamelObject}}{}, {{.lowerStartCamelPrimaryKey}}).Error
+	})
 	{{end}}
 	return err
 }
@@ -31,11 +33,13 @@ db := conn
 			}
 		}
 		return nil
-    	},tx){{else}}db := m.conn
-        if tx != nil {
-            db = tx
-        }
-        err := db.Delete(&datas).Error{{end}}
+    	},tx){{else}}err := m.ExecNoCacheCtx(ctx, func(conn *gorm.DB) error {
+		db := conn
+		if tx != nil {
+			db = tx
+		}
+		return db.Delete(&datas).Error
+	}){{end}}
 	return err
 }
 
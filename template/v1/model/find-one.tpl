@@ -13,7 +13,9 @@ func (m *default{{.upperStartCamelObject}}Model) FindOne(ctx context.Context, {{
 	default:
 		return nil, err
 	}{{else}}var resp {{.upperStartCamelObject}}
-	err := m.conn.WithContext(ctx).Model(&{{.upperStartCamelObject}}{}).Where("{{.originalPrimaryKey}} = ?", {{.lowerStartCamelPrimaryKey}}).Take(&resp).Error
+	err := m.QueryNoCacheCtx(ctx, func(conn *gorm.DB) error {
+		return conn.Model(&{{.upperStartCamelObject}}{}).Where("{{.originalPrimaryKey}} = ?", {{.lowerStartCamelPrimaryKey}}).Take(&resp).Error
+	})
 	switch err {
 	case nil:
 		return &resp, nil
@@ -25,23 +27,13 @@ func (m *default{{.upperStartCamelObject}}Model) FindOne(ctx context.Context, {{
 }
 func (m *default{{.upperStartCamelObject}}Model) FindPageList(ctx context.Context, page *pagex.ListReq, orderBys []pagex.OrderBy,
 	orderKeys map[string]string, whereClause func(db *gorm.DB) *gorm.DB) ([]{{.upperStartCamelObject}}, int64, error) {
-	{{if .withCache}}formatDB := func(conn *gorm.DB) (*gorm.DB, *gorm.DB) {
-    		db := conn.Model(&{{.upperStartCamelObject}}{})
-    		if whereClause != nil {
-    			db = whereClause(db)
-    		}
-    		return db, nil
-    	}
-    	res, total, err := pagex.FindPageListMultiOrderBy[{{.upperStartCamelObject}}](ctx, m, page, orderBys, orderKeys, formatDB)
-    	return res, total, err{{else}}conn := m.conn
-                                      	formatDB := func() (*gorm.DB, *gorm.DB) {
-                                      		db := conn.Model(&{{.upperStartCamelObject}}{})
-                                      		if whereClause != nil {
-                                      			db = whereClause(db)
-                                      		}
-                                      		return db, nil
-                                      	}
-
-                                      	res, total, err := pagex.FindPageListWithCountMultiOrderBy[{{.upperStartCamelObject}}](ctx, page, orderBys, orderKeys, formatDB)
-                                      	return res, total, err{{end}}
+	formatDB := func(conn *gorm.DB) (*gorm.DB, *gorm.DB) {
+		db := conn.Model(&{{.upperStartCamelObject}}{})
+		if whereClause != nil {
+			db = whereClause(db)
+		}
+		return db, nil
+	}
+	res, total, err := pagex.FindPageListMultiOrderBy[{{.upperStartCamelObject}}](ctx, m, page, orderBys, orderKeys, formatDB)
+	return res, total, err
 }
\ No newline at end of file
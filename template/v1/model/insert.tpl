@@ -20,11 +20,13 @@ func (m *default{{.upperStartCamelObject}}Model) Insert(ctx context.Context, tx
             db = tx
         }
         return db.Create(&data).Error
-	}, m.GetCacheKeys(data)...){{else}}db := m.conn
-        if tx != nil {
-            db = tx
-        }
-        err := db.WithContext(ctx).Create(&data).Error{{end}}
+	}, m.GetCacheKeys(data)...){{else}}err := m.ExecNoCacheCtx(ctx, func(conn *gorm.DB) error {
+		db := conn
+		if tx != nil {
+			db = tx
+		}
+		return db.Create(&data).Error
+	}){{end}}
 	return err
 }
 func (m *default{{.upperStartCamelObject}}Model) BatchInsert(ctx context.Context, tx *gorm.DB, news []{{.upperStartCamelObject}}) error {
@@ -37,10 +39,12 @@ func (m *default{{.upperStartCamelObject}}Model) BatchInsert(ctx context.Context
     			}
     		}
     		return nil
-    	},tx){{else}}db := m.conn
-        if tx != nil {
-            db = tx
-        }
-        err := db.Create(&news).Error{{end}}
+    	},tx){{else}}err := m.ExecNoCacheCtx(ctx, func(conn *gorm.DB) error {
+		db := conn
+		if tx != nil {
+			db = tx
+		}
+		return db.Create(&news).Error
+	}){{end}}
 	return err
 }
@@ -4,7 +4,7 @@ func ({{.upperStartCamelObject}}) TableName() string {
 
 func new{{.upperStartCamelObject}}Model(db *gorm.DB{{if .withCache}}, c cache.CacheConf{{end}}) *default{{.upperStartCamelObject}}Model {
 	return &default{{.upperStartCamelObject}}Model{
-		{{if .withCache}}CachedConn: gormc.NewConn(db, c){{else}}conn: db{{end}},
+		{{if .withCache}}CachedConn: gormc.NewConn(db, c){{else}}Conn: gormc.NewConnNoCache(db){{end}},
 		table: {{.table}},
 	}
 }
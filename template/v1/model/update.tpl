@@ -11,11 +11,13 @@ func (m *default{{.upperStartCamelObject}}Model) Update(ctx context.Context, tx
             db = tx
         }
         return db.Save(data).Error
-    }, clearKeys...){{else}}db := m.conn
-        if tx != nil {
-            db = tx
-        }
-        err:= db.WithContext(ctx).Save(data).Error{{end}}
+    }, clearKeys...){{else}}err := m.ExecNoCacheCtx(ctx, func(conn *gorm.DB) error {
+		db := conn
+		if tx != nil {
+			db = tx
+		}
+		return db.Save(data).Error
+	}){{end}}
     return err
 }
 func (m *default{{.upperStartCamelObject}}Model) BatchUpdate(ctx context.Context, tx *gorm.DB, olds, news []{{.upperStartCamelObject}}) error {
@@ -31,11 +33,13 @@ db := conn
 		}
 		return nil
         }, tx)
-    {{else}}db := m.conn
-        if tx != nil {
-            db = tx
-        }
-        err:= db.WithContext(ctx).Save(&news).Error
-     {{end}}
+    {{else}}err := m.ExecNoCacheCtx(ctx, func(conn *gorm.DB) error {
+		db := conn
+		if tx != nil {
+			db = tx
+		}
+		return db.Save(&news).Error
+	})
+    {{end}}
     return err
 }